@@ -5,9 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/czh0526/perception/cmd/utils"
+	"github.com/czh0526/perception/common"
 	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/rawdb"
 	"github.com/urfave/cli"
 )
 
@@ -21,6 +27,54 @@ var (
 			utils.DataDirFlag,
 		},
 	}
+	importCommand = cli.Command{
+		Action:    importChain,
+		Name:      "import",
+		Usage:     "Import a blockchain file",
+		ArgsUsage: "<filename> (<filename 2> ... <filename N>) ",
+		Category:  "Blockchain Commands",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+		},
+		Description: `
+The import command imports blocks from an RLP-encoded form. The form can be one file
+with several RLP-encoded blocks, or several files can be used. Files ending with
+.gz are decompressed on the fly.
+
+If only one file is used, import error will result in failure. If several files are
+used, processing will proceed even if an individual RLP-file import failure occurs.`,
+	}
+	rewindCommand = cli.Command{
+		Action:    rewindChain,
+		Name:      "rewind",
+		Usage:     "Rewind the blockchain to a past block",
+		ArgsUsage: "<blockNum|blockHash>",
+		Category:  "Blockchain Commands",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+		},
+		Description: `
+The rewind command deletes all canonical headers, bodies and number-to-hash
+markers above the given block, and makes it the new head of the chain. If the
+state of the target block is missing, the chain is rewound further to the
+newest block whose state is present.`,
+	}
+	exportCommand = cli.Command{
+		Action:    exportChain,
+		Name:      "export",
+		Usage:     "Export blockchain into file",
+		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
+		Category:  "Blockchain Commands",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+		},
+		Description: `
+Requires a first argument of the file to write to.
+Optional second and third arguments control the first and
+last block to write. In this mode, the file will be appended
+if already existing. If the file ends with .gz, the output will
+be gzipped.`,
+	}
 )
 
 func initGenesis(ctx *cli.Context) error {
@@ -66,3 +120,119 @@ func initGenesis(ctx *cli.Context) error {
 	}
 	return nil
 }
+
+func importChain(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer db.Close()
+	defer chain.Stop()
+
+	start := time.Now()
+	if len(ctx.Args()) == 1 {
+		if err := utils.ImportChain(chain, ctx.Args().First()); err != nil {
+			fmt.Printf("Error: Import error: %v. \n", err)
+			return err
+		}
+	} else {
+		for _, arg := range ctx.Args() {
+			if err := utils.ImportChain(chain, arg); err != nil {
+				fmt.Printf("Error: Import error, file = %s, err = %v. \n", arg, err)
+			}
+		}
+	}
+	fmt.Printf("Import done in %v. \n", time.Since(start))
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Printf("Object memory: %.3f MB current, %.3f MB peak \n", float64(mem.Alloc)/1024/1024, float64(mem.Sys)/1024/1024)
+	fmt.Printf("Head block: #%d [%x] \n", chain.CurrentBlock().NumberU64(), chain.CurrentBlock().Hash())
+	return nil
+}
+
+func exportChain(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer db.Close()
+	defer chain.Stop()
+
+	start := time.Now()
+
+	var err error
+	fp := ctx.Args().First()
+	if len(ctx.Args()) < 3 {
+		err = utils.ExportChain(chain, fp)
+	} else {
+		// This can be improved to allow for numbers larger than 9223372036854775807
+		first, ferr := strconv.ParseInt(ctx.Args().Get(1), 10, 64)
+		last, lerr := strconv.ParseInt(ctx.Args().Get(2), 10, 64)
+		if ferr != nil || lerr != nil {
+			utils.Fatalf("Export error in parsing parameters: block number not an integer")
+		}
+		if first < 0 || last < 0 {
+			utils.Fatalf("Export error: block number must be greater than 0")
+		}
+		err = utils.ExportAppendChain(chain, fp, uint64(first), uint64(last))
+	}
+
+	if err != nil {
+		utils.Fatalf("Export error: %v", err)
+	}
+	fmt.Printf("Export done in %v. \n", time.Since(start))
+	return nil
+}
+
+func rewindChain(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer db.Close()
+	defer chain.Stop()
+
+	var (
+		arg    = ctx.Args().First()
+		target uint64
+	)
+	if len(arg) == 2+2*common.HashLength && strings.HasPrefix(arg, "0x") {
+		hash := common.HexToHash(arg)
+		number := rawdb.ReadHeaderNumber(db, hash)
+		if number == nil {
+			utils.Fatalf("Rewind error: block %x not found", hash)
+		}
+		if rawdb.ReadCanonicalHash(db, *number) != hash {
+			utils.Fatalf("Rewind error: block %x is not canonical", hash)
+		}
+		target = *number
+	} else {
+		number, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			utils.Fatalf("Rewind error in parsing parameters: %v", err)
+		}
+		target = number
+	}
+
+	head := chain.CurrentHeader().Number.Uint64()
+	if target >= head {
+		fmt.Printf("Nothing to rewind, head header = #%d, target = #%d. \n", head, target)
+		return nil
+	}
+	if err := chain.SetHead(target); err != nil {
+		utils.Fatalf("Rewind error: %v", err)
+	}
+	fmt.Printf("Rewound blockchain, discarded = %d, head block = #%d [%x]. \n",
+		head-chain.CurrentBlock().NumberU64(), chain.CurrentBlock().NumberU64(), chain.CurrentBlock().Hash())
+	return nil
+}
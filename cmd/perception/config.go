@@ -50,6 +50,11 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 		fmt.Printf("Failed to register the Proton service: %v", err)
 		return nil
 	}
+
+	// GraphQL 依赖 Proton service, 必须在其之后注册
+	if ctx.GlobalBool(utils.GraphQLEnabledFlag.Name) {
+		utils.RegisterGraphQLService(nd)
+	}
 	return nd
 }
 
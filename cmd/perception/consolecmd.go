@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/czh0526/perception/cmd/utils"
+	"github.com/czh0526/perception/console"
+	"github.com/czh0526/perception/node"
+	"github.com/czh0526/perception/rpc"
+	"github.com/urfave/cli"
+)
+
+var (
+	consoleCommand = cli.Command{
+		Action:   localConsole,
+		Name:     "console",
+		Usage:    "Start an interactive console with a running node",
+		Category: "Console Commands",
+		Description: `The console starts a node and opens an interactive RPC console on top of it.
+Statements have the form namespace.method(arg, ...) with JSON arguments.`,
+	}
+	attachCommand = cli.Command{
+		Action:    remoteConsole,
+		Name:      "attach",
+		Usage:     "Start an interactive console attached to a running node",
+		ArgsUsage: "[endpoint]",
+		Category:  "Console Commands",
+		Description: `The console connects to a running node over IPC, WebSocket or HTTP.
+Without an endpoint the IPC socket inside --datadir is used.`,
+	}
+)
+
+// localConsole 启动节点并在其上打开控制台
+func localConsole(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+	startNode(stack)
+
+	client, err := stack.Attach()
+	if err != nil {
+		return fmt.Errorf("failed to attach to the node: %v", err)
+	}
+	return runConsole(stack.DataDir(), client)
+}
+
+// remoteConsole 连接到正在运行的节点并打开控制台
+func remoteConsole(ctx *cli.Context) error {
+	endpoint := ctx.Args().First()
+	if endpoint == "" {
+		conf := node.DefaultConfig
+		utils.SetNodeConfig(ctx, &conf)
+		endpoint = conf.IPCEndpoint()
+	}
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to attach to remote node: %v", err)
+	}
+	return runConsole(ctx.GlobalString(utils.DataDirFlag.Name), client)
+}
+
+func runConsole(datadir string, client *rpc.Client) error {
+	defer client.Close()
+
+	c, err := console.New(console.Config{
+		DataDir: datadir,
+		Client:  client,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start the console: %v", err)
+	}
+	defer c.Stop()
+
+	c.Welcome()
+	c.Interactive()
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/czh0526/perception/cmd/utils"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/proton/chaindb"
+	"github.com/czh0526/perception/proton/core/rawdb"
+	"github.com/urfave/cli"
+)
+
+var (
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "Database Commands",
+		Subcommands: []cli.Command{
+			dbInspectCmd,
+			dbStatCmd,
+			dbCompactCmd,
+			dbGetCmd,
+			dbDeleteCmd,
+		},
+	}
+	dbInspectCmd = cli.Command{
+		Action:    inspect,
+		Name:      "inspect",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+		},
+		Usage:       "Inspect the storage size for each type of data in the database",
+		Description: `This commands iterates the entire database and prints the item counts and sizes per category.`,
+	}
+	dbStatCmd = cli.Command{
+		Action: dbStats,
+		Name:   "stat",
+		Usage:  "Print leveldb statistics",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+		},
+	}
+	dbCompactCmd = cli.Command{
+		Action: dbCompact,
+		Name:   "compact",
+		Usage:  "Compact leveldb database. WARNING: May take a very long time",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+		},
+		Description: `This command performs a database compaction.
+WARNING: This operation may take a very long time to finish, and may cause database
+corruption if it is aborted during execution!`,
+	}
+	dbGetCmd = cli.Command{
+		Action:      dbGet,
+		Name:        "get",
+		Usage:       "Show the value of a database key",
+		ArgsUsage:   "<hex-encoded key | name>",
+		Flags:       []cli.Flag{utils.DataDirFlag},
+		Description: "This command looks up the specified database key from the database.",
+	}
+	dbDeleteCmd = cli.Command{
+		Action:    dbDelete,
+		Name:      "delete",
+		Usage:     "Delete a database key (WARNING: may corrupt your database)",
+		ArgsUsage: "<hex-encoded key | name>",
+		Flags:     []cli.Flag{utils.DataDirFlag},
+		Description: `This command deletes the specified database key from the database.
+WARNING: This is a low-level operation which may cause database corruption!`,
+	}
+)
+
+func inspect(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	return rawdb.InspectDatabase(db, os.Stdout)
+}
+
+func dbStats(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	showLeveldbStats(db)
+	return nil
+}
+
+func dbCompact(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	fmt.Println("Stats before compaction")
+	showLeveldbStats(db)
+
+	fmt.Println("Triggering compaction")
+	if err := db.Compact(nil, nil); err != nil {
+		fmt.Printf("Error: Compact err: %v. \n", err)
+		return err
+	}
+
+	fmt.Println("Stats after compaction")
+	showLeveldbStats(db)
+	return nil
+}
+
+func showLeveldbStats(db chaindb.Stater) {
+	if stats, err := db.Stat("leveldb.stats"); err != nil {
+		fmt.Printf("Error: Failed to read database stats: %v. \n", err)
+	} else {
+		fmt.Println(stats)
+	}
+	if ioStats, err := db.Stat("leveldb.iostats"); err != nil {
+		fmt.Printf("Error: Failed to read database iostats: %v. \n", err)
+	} else {
+		fmt.Println(ioStats)
+	}
+}
+
+func dbGet(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	key, err := parseHexOrString(ctx.Args().Get(0))
+	if err != nil {
+		fmt.Printf("Error: Could not decode the key: %v. \n", err)
+		return err
+	}
+	data, err := db.Get(key)
+	if err != nil {
+		fmt.Printf("Error: Get operation failed, key = %#x, err = %v. \n", key, err)
+		return err
+	}
+	fmt.Printf("key %#x: %#x\n", key, data)
+	return nil
+}
+
+func dbDelete(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	stack := makeFullNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	key, err := parseHexOrString(ctx.Args().Get(0))
+	if err != nil {
+		fmt.Printf("Error: Could not decode the key: %v. \n", err)
+		return err
+	}
+	data, err := db.Get(key)
+	if err == nil {
+		fmt.Printf("Previous value: %#x\n", data)
+	}
+	if err = db.Delete(key); err != nil {
+		fmt.Printf("Error: Delete operation returned an error, key = %#x, err = %v. \n", key, err)
+		return err
+	}
+	return nil
+}
+
+// 以 0x 开头的参数按 hex 解码, 其余的按字符串处理 (如 "LastBlock")
+func parseHexOrString(str string) ([]byte, error) {
+	if strings.HasPrefix(str, "0x") {
+		return hexutil.Decode(str)
+	}
+	return []byte(str), nil
+}
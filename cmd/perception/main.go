@@ -25,9 +25,36 @@ func init() {
 		utils.DataDirFlag,
 		utils.ListenPortFlag,
 		utils.BootnodesFlag,
+		utils.MaxPeersFlag,
+		utils.NoDiscoverFlag,
+		utils.MDNSFlag,
+		utils.NATFlag,
+		utils.AutoNATFlag,
+		utils.RelayFlag,
+		utils.AutoRelayFlag,
+		utils.IPCDisabledFlag,
+		utils.IPCPathFlag,
+		utils.RPCEnabledFlag,
+		utils.RPCListenAddrFlag,
+		utils.RPCPortFlag,
+		utils.RPCCORSDomainFlag,
+		utils.RPCVirtualHostsFlag,
+		utils.RPCApiFlag,
+		utils.WSEnabledFlag,
+		utils.WSListenAddrFlag,
+		utils.WSPortFlag,
+		utils.WSApiFlag,
+		utils.WSAllowedOriginsFlag,
+		utils.GraphQLEnabledFlag,
 	}
 	app.Commands = []cli.Command{
 		initProtonCommand,
+		importCommand,
+		exportCommand,
+		rewindCommand,
+		dbCommand,
+		consoleCommand,
+		attachCommand,
 	}
 }
 
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rlp"
+)
+
+const (
+	importBatchSize = 2500
+)
+
+func Fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "Fatal: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func ImportChain(chain *core.BlockChain, fn string) error {
+	// 捕获中断信号，在两个批次之间退出
+	interrupt := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	defer close(interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			log.Println("Interrupted during import, stopping at next batch")
+		}
+		close(stop)
+	}()
+	checkInterrupt := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+
+	log.Printf("Importing blockchain, file = %s", fn)
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var reader io.Reader = fh
+	if strings.HasSuffix(fn, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return err
+		}
+	}
+	stream := rlp.NewStream(reader, 0)
+
+	var (
+		start    = time.Now()
+		imported = 0
+		blocks   = make([]*types.Block, importBatchSize)
+		n        = 0
+	)
+	for batch := 0; ; batch++ {
+		// 读取一个批次的区块
+		if checkInterrupt() {
+			return fmt.Errorf("interrupted")
+		}
+		i := 0
+		for ; i < importBatchSize; i++ {
+			var b types.Block
+			if err := stream.Decode(&b); err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("at block %d: %v", n, err)
+			}
+			// 跳过 genesis block
+			if b.NumberU64() == 0 {
+				i--
+				continue
+			}
+			blocks[i] = &b
+			n++
+		}
+		if i == 0 {
+			break
+		}
+
+		// 插入链中
+		if checkInterrupt() {
+			return fmt.Errorf("interrupted")
+		}
+		missing := missingBlocks(chain, blocks[:i])
+		if len(missing) == 0 {
+			log.Printf("Skipping batch as all blocks present, batch = %d, first = %x, last = %x",
+				batch, blocks[0].Hash(), blocks[i-1].Hash())
+			continue
+		}
+		index, err := chain.InsertChain(missing)
+		if err != nil {
+			if index < len(missing) && core.IsConsensusError(err) {
+				chain.ReportBadBlock(missing[index], err, "")
+			}
+			return fmt.Errorf("invalid block %d: %v", n, err)
+		}
+		// parent 未知或者时间戳超前的区块只会被暂存, 退出后丢失
+		if last := missing[len(missing)-1]; !chain.HasBlock(last.Hash(), last.NumberU64()) {
+			return fmt.Errorf("block %d not imported: parent %x unknown or timestamp in the future",
+				missing[index].NumberU64(), missing[index].ParentHash())
+		}
+		imported += len(missing)
+		log.Printf("Imported new chain segment, blocks = %d, number = %d, elapsed = %v",
+			imported, chain.CurrentBlock().NumberU64(), time.Since(start))
+	}
+	log.Printf("Import done, blocks = %d, elapsed = %v", imported, time.Since(start))
+	return nil
+}
+
+func missingBlocks(chain *core.BlockChain, blocks []*types.Block) []*types.Block {
+	head := chain.CurrentBlock()
+	for i, block := range blocks {
+		// 已经在链中的区块无需重复导入
+		if head.NumberU64() >= block.NumberU64() && chain.HasBlock(block.Hash(), block.NumberU64()) {
+			continue
+		}
+		return blocks[i:]
+	}
+	return nil
+}
+
+func ExportChain(blockchain *core.BlockChain, fn string) error {
+	log.Printf("Exporting blockchain, file = %s", fn)
+
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	if err := blockchain.Export(writer); err != nil {
+		return err
+	}
+	log.Printf("Exported blockchain, file = %s", fn)
+	return nil
+}
+
+func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, last uint64) error {
+	log.Printf("Exporting blockchain, file = %s", fn)
+
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	if err := blockchain.ExportN(writer, first, last); err != nil {
+		return err
+	}
+	log.Printf("Exported blockchain to, file = %s", fn)
+	return nil
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/rawdb"
+)
+
+func newTestChain(t *testing.T, n int) *core.BlockChain {
+	gspec := &core.Genesis{Alloc: core.GenesisAlloc{
+		common.BytesToAddress([]byte{1}): {Balance: big.NewInt(1000)},
+	}}
+	bc, _, err := core.GenerateBlockChain(rawdb.NewMemoryDatabase(), gspec, n, nil)
+	if err != nil {
+		t.Fatalf("failed to generate chain: %v", err)
+	}
+	t.Cleanup(bc.Stop)
+	return bc
+}
+
+func TestImportChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "import-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := newTestChain(t, 4)
+	full, segment := filepath.Join(dir, "full.rlp"), filepath.Join(dir, "segment.rlp")
+	if err := ExportChain(source, full); err != nil {
+		t.Fatalf("failed to export chain: %v", err)
+	}
+	if err := ExportAppendChain(source, segment, 3, 4); err != nil {
+		t.Fatalf("failed to export segment: %v", err)
+	}
+
+	// 与本地链不相连的区块段不能被当作导入成功
+	chain := newTestChain(t, 0)
+	if err := ImportChain(chain, segment); err == nil {
+		t.Fatalf("disconnected segment imported without error")
+	}
+	if num := chain.CurrentBlock().NumberU64(); num != 0 {
+		t.Fatalf("head moved by disconnected segment: have %d, want 0", num)
+	}
+
+	if err := ImportChain(chain, full); err != nil {
+		t.Fatalf("failed to import chain: %v", err)
+	}
+	if head := chain.CurrentBlock(); head.Hash() != source.CurrentBlock().Hash() {
+		t.Fatalf("head mismatch: have %d, want %d", head.NumberU64(), source.CurrentBlock().NumberU64())
+	}
+}
@@ -3,12 +3,16 @@ package utils
 import (
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"strings"
 
+	"github.com/czh0526/perception/graphql"
 	"github.com/czh0526/perception/node"
 	"github.com/czh0526/perception/p2p"
 	"github.com/czh0526/perception/proton"
+	"github.com/czh0526/perception/proton/chaindb"
+	"github.com/czh0526/perception/proton/core"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
 	ma "github.com/multiformats/go-multiaddr"
@@ -33,6 +37,11 @@ var (
 		Usage: "Network listening port",
 		Value: 10000,
 	}
+	MaxPeersFlag = cli.IntFlag{
+		Name:  "maxpeers",
+		Usage: "Maximum number of network peers",
+		Value: node.DefaultConfig.P2P.MaxPeers,
+	}
 	NetworkIdFlag = cli.Uint64Flag{
 		Name:  "networkid",
 		Usage: "Network identifier",
@@ -43,6 +52,99 @@ var (
 		Usage: "Comma separated node urls for P2P discovery bootstrap.",
 		Value: "",
 	}
+	NoDiscoverFlag = cli.BoolFlag{
+		Name:  "nodiscover",
+		Usage: "Disables DHT peer discovery (bootnodes, static peers and mDNS still work)",
+	}
+	MDNSFlag = cli.BoolFlag{
+		Name:  "mdns",
+		Usage: "Enables local network peer discovery via mDNS",
+	}
+	NATFlag = cli.StringFlag{
+		Name:  "nat",
+		Usage: "NAT port mapping mechanism (none|any|extip:<IP>)",
+		Value: "none",
+	}
+	AutoNATFlag = cli.BoolFlag{
+		Name:  "autonat",
+		Usage: "Enables AutoNAT reachability detection",
+	}
+	RelayFlag = cli.StringFlag{
+		Name:  "relay",
+		Usage: "Circuit relay mode (off|client|hop)",
+		Value: p2p.RelayClient,
+	}
+	AutoRelayFlag = cli.BoolFlag{
+		Name:  "autorelay",
+		Usage: "Announces relay addresses when behind a NAT (advertises this node as a relay in hop mode)",
+	}
+
+	// RPC settings
+	IPCDisabledFlag = cli.BoolFlag{
+		Name:  "ipcdisable",
+		Usage: "Disable the IPC-RPC server",
+	}
+	IPCPathFlag = cli.StringFlag{
+		Name:  "ipcpath",
+		Usage: "Filename for IPC socket/pipe within the datadir (explicit paths escape it)",
+	}
+	RPCEnabledFlag = cli.BoolFlag{
+		Name:  "rpc",
+		Usage: "Enable the HTTP-RPC server",
+	}
+	RPCListenAddrFlag = cli.StringFlag{
+		Name:  "rpcaddr",
+		Usage: "HTTP-RPC server listening interface",
+		Value: node.DefaultHTTPHost,
+	}
+	RPCPortFlag = cli.IntFlag{
+		Name:  "rpcport",
+		Usage: "HTTP-RPC server listening port",
+		Value: node.DefaultHTTPPort,
+	}
+	RPCCORSDomainFlag = cli.StringFlag{
+		Name:  "rpccorsdomain",
+		Usage: "Comma separated list of domains from which to accept cross origin requests (browser enforced)",
+		Value: "",
+	}
+	RPCVirtualHostsFlag = cli.StringFlag{
+		Name:  "rpcvhosts",
+		Usage: "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
+		Value: strings.Join(node.DefaultConfig.HTTPVirtualHosts, ","),
+	}
+	RPCApiFlag = cli.StringFlag{
+		Name:  "rpcapi",
+		Usage: "API's offered over the HTTP-RPC interface",
+		Value: "",
+	}
+	WSEnabledFlag = cli.BoolFlag{
+		Name:  "ws",
+		Usage: "Enable the WS-RPC server",
+	}
+	WSListenAddrFlag = cli.StringFlag{
+		Name:  "wsaddr",
+		Usage: "WS-RPC server listening interface",
+		Value: node.DefaultWSHost,
+	}
+	WSPortFlag = cli.IntFlag{
+		Name:  "wsport",
+		Usage: "WS-RPC server listening port",
+		Value: node.DefaultWSPort,
+	}
+	WSApiFlag = cli.StringFlag{
+		Name:  "wsapi",
+		Usage: "API's offered over the WS-RPC interface",
+		Value: "",
+	}
+	WSAllowedOriginsFlag = cli.StringFlag{
+		Name:  "wsorigins",
+		Usage: "Origins from which to accept websockets requests",
+		Value: "",
+	}
+	GraphQLEnabledFlag = cli.BoolFlag{
+		Name:  "graphql",
+		Usage: "Enable GraphQL on the HTTP-RPC server (requires --rpc)",
+	}
 )
 
 func SetProtonConfig(ctx *cli.Context, stack *node.Node, conf *proton.Config) {
@@ -61,12 +163,96 @@ func SetNodeConfig(ctx *cli.Context, conf *node.Config) {
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		conf.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
+
+	setIPC(ctx, conf)
+	setHTTP(ctx, conf)
+	setWS(ctx, conf)
+}
+
+func setIPC(ctx *cli.Context, conf *node.Config) {
+	switch {
+	case ctx.GlobalBool(IPCDisabledFlag.Name):
+		conf.IPCPath = ""
+	case ctx.GlobalIsSet(IPCPathFlag.Name):
+		conf.IPCPath = ctx.GlobalString(IPCPathFlag.Name)
+	}
+}
+
+func setHTTP(ctx *cli.Context, conf *node.Config) {
+	if ctx.GlobalBool(RPCEnabledFlag.Name) && conf.HTTPHost == "" {
+		conf.HTTPHost = node.DefaultHTTPHost
+		if ctx.GlobalIsSet(RPCListenAddrFlag.Name) {
+			conf.HTTPHost = ctx.GlobalString(RPCListenAddrFlag.Name)
+		}
+	}
+	if ctx.GlobalIsSet(RPCPortFlag.Name) {
+		conf.HTTPPort = ctx.GlobalInt(RPCPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCCORSDomainFlag.Name) {
+		conf.HTTPCors = splitAndTrim(ctx.GlobalString(RPCCORSDomainFlag.Name))
+	}
+	if ctx.GlobalIsSet(RPCApiFlag.Name) {
+		conf.HTTPModules = splitAndTrim(ctx.GlobalString(RPCApiFlag.Name))
+	}
+	if ctx.GlobalIsSet(RPCVirtualHostsFlag.Name) {
+		conf.HTTPVirtualHosts = splitAndTrim(ctx.GlobalString(RPCVirtualHostsFlag.Name))
+	}
+}
+
+func setWS(ctx *cli.Context, conf *node.Config) {
+	if ctx.GlobalBool(WSEnabledFlag.Name) && conf.WSHost == "" {
+		conf.WSHost = node.DefaultWSHost
+		if ctx.GlobalIsSet(WSListenAddrFlag.Name) {
+			conf.WSHost = ctx.GlobalString(WSListenAddrFlag.Name)
+		}
+	}
+	if ctx.GlobalIsSet(WSPortFlag.Name) {
+		conf.WSPort = ctx.GlobalInt(WSPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(WSAllowedOriginsFlag.Name) {
+		conf.WSOrigins = splitAndTrim(ctx.GlobalString(WSAllowedOriginsFlag.Name))
+	}
+	if ctx.GlobalIsSet(WSApiFlag.Name) {
+		conf.WSModules = splitAndTrim(ctx.GlobalString(WSApiFlag.Name))
+	}
+}
+
+// 按逗号分割字符串, 并去掉每一项首尾的空白和空项
+func splitAndTrim(input string) []string {
+	result := strings.Split(input, ",")
+	ret := make([]string, 0, len(result))
+	for _, r := range result {
+		if r = strings.TrimSpace(r); r != "" {
+			ret = append(ret, r)
+		}
+	}
+	return ret
 }
 
 func SetP2PConfig(ctx *cli.Context, conf *p2p.Config) {
 	setNodeKey(ctx, conf)
 	setListenAddress(ctx, conf)
 	setBootNodes(ctx, conf)
+
+	if ctx.GlobalIsSet(MaxPeersFlag.Name) {
+		conf.MaxPeers = ctx.GlobalInt(MaxPeersFlag.Name)
+	}
+	if ctx.GlobalIsSet(NoDiscoverFlag.Name) {
+		conf.NoDiscovery = true
+	}
+	if ctx.GlobalIsSet(MDNSFlag.Name) {
+		conf.MDNS = true
+	}
+	setNAT(ctx, conf)
+	if ctx.GlobalIsSet(AutoNATFlag.Name) {
+		conf.AutoNAT = true
+	}
+	if ctx.GlobalIsSet(RelayFlag.Name) {
+		conf.Relay = ctx.GlobalString(RelayFlag.Name)
+	}
+	if ctx.GlobalIsSet(AutoRelayFlag.Name) {
+		conf.AutoRelay = true
+	}
 }
 
 func setNodeKey(ctx *cli.Context, conf *p2p.Config) {
@@ -104,6 +290,39 @@ func setListenAddress(ctx *cli.Context, conf *p2p.Config) {
 	}
 }
 
+// 解析 --nat, extip 使用监听端口作为外部端口, 需要在 setListenAddress 之后调用
+func setNAT(ctx *cli.Context, conf *p2p.Config) {
+	if !ctx.GlobalIsSet(NATFlag.Name) {
+		return
+	}
+	switch spec := ctx.GlobalString(NATFlag.Name); {
+	case spec == "none":
+		conf.NAT = false
+	case spec == "any" || spec == "upnp" || spec == "pmp":
+		conf.NAT = true
+	case strings.HasPrefix(spec, "extip:"):
+		ip := net.ParseIP(strings.TrimPrefix(spec, "extip:"))
+		if ip == nil {
+			Fatalf("Option %s: invalid IP address in %q", NATFlag.Name, spec)
+		}
+		listenAddr, err := ma.NewMultiaddr(conf.ListenAddr)
+		if err != nil {
+			Fatalf("Option %s: invalid listen address %q: %v", NATFlag.Name, conf.ListenAddr, err)
+		}
+		port, err := listenAddr.ValueForProtocol(ma.P_TCP)
+		if err != nil {
+			Fatalf("Option %s: listen address %q has no tcp port", NATFlag.Name, conf.ListenAddr)
+		}
+		proto := "ip4"
+		if ip.To4() == nil {
+			proto = "ip6"
+		}
+		conf.ExternalAddrs = append(conf.ExternalAddrs, fmt.Sprintf("/%s/%s/tcp/%s", proto, ip, port))
+	default:
+		Fatalf("Option %s: unknown mechanism %q", NATFlag.Name, spec)
+	}
+}
+
 func setBootNodes(ctx *cli.Context, conf *p2p.Config) {
 	urls := []string{}
 	switch {
@@ -125,3 +344,38 @@ func setBootNodes(ctx *cli.Context, conf *p2p.Config) {
 		conf.BootstrapPeers = append(conf.BootstrapPeers, url)
 	}
 }
+
+func MakeChainDatabase(ctx *cli.Context, stack *node.Node) chaindb.Database {
+	var (
+		cache   = proton.DefaultConfig.DatabaseCache
+		handles = proton.DefaultConfig.DatabaseHandles
+	)
+	chainDb, err := stack.OpenDatabase("chaindata", cache, handles, "")
+	if err != nil {
+		Fatalf("Could not open database: %v", err)
+	}
+	return chainDb
+}
+
+func MakeChain(ctx *cli.Context, stack *node.Node) (*core.BlockChain, chaindb.Database) {
+	chainDb := MakeChainDatabase(ctx, stack)
+	chain, err := core.NewBlockChain(chainDb)
+	if err != nil {
+		Fatalf("Can't create BlockChain: %v", err)
+	}
+	return chain, chainDb
+}
+
+// 注册 GraphQL service, 必须在 Proton service 之后注册
+func RegisterGraphQLService(stack *node.Node) {
+	err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var protonServ *proton.Proton
+		if err := ctx.Service(&protonServ); err != nil {
+			return nil, err
+		}
+		return graphql.New(ctx, protonServ)
+	})
+	if err != nil {
+		Fatalf("Failed to register the GraphQL service: %v", err)
+	}
+}
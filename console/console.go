@@ -0,0 +1,276 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/czh0526/perception/rpc"
+	"github.com/peterh/liner"
+)
+
+const (
+	// 保存在 DataDir 中的历史记录文件
+	HistoryFile = "console_history"
+
+	// 默认的提示符
+	DefaultPrompt = "> "
+)
+
+// 控制台内置的命令
+var builtins = []string{"exit", "help", "modules"}
+
+var errExit = errors.New("exit")
+
+// Config 是创建 Console 的参数
+type Config struct {
+	DataDir  string       // 保存历史记录的目录, 为空时不保存
+	Client   *rpc.Client  // 连接节点的 RPC client
+	Prompt   string       // 提示符, 默认为 DefaultPrompt
+	Prompter UserPrompter // 读取用户输入, 默认为终端
+	Printer  io.Writer    // 输出结果, 默认为标准输出
+}
+
+// Console 是一个连接到节点的交互式 RPC 终端, 语句的形式为 namespace.method(arg, ...),
+// 参数按照 JSON 解析
+type Console struct {
+	client   *rpc.Client
+	prompt   string
+	prompter UserPrompter
+	histPath string
+	history  []string
+	printer  io.Writer
+
+	modules map[string]string   // 节点开放的模块及其版本
+	methods map[string][]string // 每个模块下的方法名
+}
+
+// New 创建 Console, 并从节点读取可用的模块和方法
+func New(config Config) (*Console, error) {
+	if config.Client == nil {
+		return nil, errors.New("console: nil rpc client")
+	}
+	if config.Prompt == "" {
+		config.Prompt = DefaultPrompt
+	}
+	if config.Prompter == nil {
+		config.Prompter = NewTerminalPrompter()
+	}
+	if config.Printer == nil {
+		config.Printer = os.Stdout
+	}
+	console := &Console{
+		client:   config.Client,
+		prompt:   config.Prompt,
+		prompter: config.Prompter,
+		printer:  config.Printer,
+	}
+	if config.DataDir != "" {
+		console.histPath = filepath.Join(config.DataDir, HistoryFile)
+	}
+	if err := console.init(); err != nil {
+		return nil, err
+	}
+	return console, nil
+}
+
+func (c *Console) init() error {
+	modules, err := c.client.SupportedModules()
+	if err != nil {
+		return fmt.Errorf("api modules: %v", err)
+	}
+	c.modules = modules
+
+	var methods map[string][]string
+	if err := c.client.Call(&methods, "rpc_methods"); err != nil {
+		return fmt.Errorf("api methods: %v", err)
+	}
+	c.methods = methods
+
+	// 读取历史记录
+	if c.histPath != "" {
+		if content, err := ioutil.ReadFile(c.histPath); err == nil {
+			c.history = strings.Split(strings.TrimSpace(string(content)), "\n")
+			c.prompter.SetHistory(c.history)
+		}
+	}
+	c.prompter.SetWordCompleter(c.AutoCompleteInput)
+	return nil
+}
+
+// Welcome 打印欢迎信息和可用的模块
+func (c *Console) Welcome() {
+	fmt.Fprintf(c.printer, "Welcome to the Perception console!\n\n")
+	fmt.Fprintf(c.printer, " modules: %s\n\n", c.moduleList())
+	fmt.Fprintf(c.printer, "To exit, press ctrl-d or type exit\n")
+}
+
+func (c *Console) moduleList() string {
+	names := make([]string, 0, len(c.modules))
+	for name, version := range c.modules {
+		names = append(names, fmt.Sprintf("%s:%s", name, version))
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// AutoCompleteInput 补全光标所在的单词, 单词为内置命令, 模块名或者 namespace.method
+func (c *Console) AutoCompleteInput(line string, pos int) (string, []string, string) {
+	if len(line) == 0 || pos == 0 {
+		return "", nil, ""
+	}
+	// 向前找到单词的起始位置
+	start := pos - 1
+	for ; start > 0; start-- {
+		if ch := line[start-1]; ch != '.' && ch != '_' && !isAlphaNumeric(ch) {
+			break
+		}
+	}
+	word := line[start:pos]
+
+	var candidates []string
+	if dot := strings.Index(word, "."); dot >= 0 {
+		namespace, prefix := word[:dot], word[dot+1:]
+		for _, method := range c.methods[namespace] {
+			if strings.HasPrefix(method, prefix) {
+				candidates = append(candidates, namespace+"."+method)
+			}
+		}
+	} else {
+		for _, name := range builtins {
+			if strings.HasPrefix(name, word) {
+				candidates = append(candidates, name)
+			}
+		}
+		for namespace := range c.methods {
+			if strings.HasPrefix(namespace, word) {
+				candidates = append(candidates, namespace+".")
+			}
+		}
+	}
+	sort.Strings(candidates)
+	return line[:start], candidates, line[pos:]
+}
+
+func isAlphaNumeric(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+// Evaluate 执行一条语句并打印结果, 出错时打印错误信息
+func (c *Console) Evaluate(statement string) {
+	if err := c.evaluate(statement); err != nil && err != errExit {
+		fmt.Fprintf(c.printer, "Error: %v\n", err)
+	}
+}
+
+func (c *Console) evaluate(statement string) error {
+	statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+	switch statement {
+	case "":
+		return nil
+	case "exit":
+		return errExit
+	case "help":
+		fmt.Fprintf(c.printer, "Usage: namespace.method(arg, ...), arguments are JSON values\n")
+		fmt.Fprintf(c.printer, "Type a namespace to list its methods, modules to list the namespaces\n")
+		return nil
+	case "modules":
+		fmt.Fprintln(c.printer, c.moduleList())
+		return nil
+	}
+	// 只有 namespace 时列出它的方法
+	if methods, ok := c.methods[statement]; ok {
+		for _, method := range methods {
+			fmt.Fprintf(c.printer, "%s.%s\n", statement, method)
+		}
+		return nil
+	}
+
+	namespace, method, args, err := parseCall(statement)
+	if err != nil {
+		return err
+	}
+	var result json.RawMessage
+	if err := c.client.Call(&result, namespace+"_"+method, args...); err != nil {
+		return err
+	}
+	return c.print(result)
+}
+
+// parseCall 把 namespace.method(args) 拆分为 RPC 调用的参数, 省略括号时表示无参数
+func parseCall(statement string) (string, string, []interface{}, error) {
+	call, params := statement, ""
+	if open := strings.Index(statement, "("); open >= 0 {
+		if !strings.HasSuffix(statement, ")") {
+			return "", "", nil, fmt.Errorf("missing ')' in %q", statement)
+		}
+		call, params = statement[:open], statement[open+1:len(statement)-1]
+	}
+	dot := strings.Index(call, ".")
+	if dot <= 0 || dot == len(call)-1 {
+		return "", "", nil, fmt.Errorf("invalid statement %q, expected namespace.method(...)", statement)
+	}
+	var args []interface{}
+	if strings.TrimSpace(params) != "" {
+		dec := json.NewDecoder(strings.NewReader("[" + params + "]"))
+		dec.UseNumber()
+		if err := dec.Decode(&args); err != nil {
+			return "", "", nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+	}
+	return strings.TrimSpace(call[:dot]), strings.TrimSpace(call[dot+1:]), args, nil
+}
+
+// print 以缩进的格式打印 JSON 结果
+func (c *Console) print(result json.RawMessage) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, result, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(c.printer)
+	return err
+}
+
+// Interactive 循环读取用户输入并执行, 直到用户退出或者输入结束
+func (c *Console) Interactive() {
+	for {
+		line, err := c.prompter.PromptInput(c.prompt)
+		if err == liner.ErrPromptAborted {
+			// Ctrl-C 只放弃当前输入
+			continue
+		}
+		if err != nil {
+			fmt.Fprintln(c.printer)
+			return
+		}
+		if command := strings.TrimSpace(line); command != "" {
+			if len(c.history) == 0 || command != c.history[len(c.history)-1] {
+				c.history = append(c.history, command)
+				c.prompter.AppendHistory(command)
+			}
+			if err := c.evaluate(command); err == errExit {
+				return
+			} else if err != nil {
+				fmt.Fprintf(c.printer, "Error: %v\n", err)
+			}
+		}
+	}
+}
+
+// Stop 保存历史记录并恢复终端
+func (c *Console) Stop() error {
+	if c.histPath != "" && len(c.history) > 0 {
+		if err := ioutil.WriteFile(c.histPath, []byte(strings.Join(c.history, "\n")), 0600); err != nil {
+			return err
+		}
+	}
+	return c.prompter.Close()
+}
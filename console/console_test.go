@@ -0,0 +1,153 @@
+package console
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/czh0526/perception/rpc"
+)
+
+// hookedPrompter 依次返回预先设置的输入
+type hookedPrompter struct {
+	inputs    []string
+	history   []string
+	completer WordCompleter
+}
+
+func (p *hookedPrompter) PromptInput(prompt string) (string, error) {
+	if len(p.inputs) == 0 {
+		return "", io.EOF
+	}
+	input := p.inputs[0]
+	p.inputs = p.inputs[1:]
+	return input, nil
+}
+
+func (p *hookedPrompter) SetHistory(history []string)              { p.history = history }
+func (p *hookedPrompter) AppendHistory(command string)             { p.history = append(p.history, command) }
+func (p *hookedPrompter) SetWordCompleter(completer WordCompleter) { p.completer = completer }
+func (p *hookedPrompter) Close() error                             { return nil }
+
+type testService struct{}
+
+func (s *testService) Echo(str string, n int) map[string]interface{} {
+	return map[string]interface{}{"str": str, "n": n}
+}
+
+func (s *testService) Empty() string { return "empty" }
+
+type tester struct {
+	console  *Console
+	prompter *hookedPrompter
+	output   *bytes.Buffer
+	datadir  string
+}
+
+func newTester(t *testing.T, inputs ...string) *tester {
+	server := rpc.NewServer()
+	if err := server.RegisterName("test", new(testService)); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	datadir, err := ioutil.TempDir("", "console-test")
+	if err != nil {
+		t.Fatalf("failed to create datadir: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Stop()
+		os.RemoveAll(datadir)
+	})
+
+	prompter := &hookedPrompter{inputs: inputs}
+	output := new(bytes.Buffer)
+	console, err := New(Config{DataDir: datadir, Client: client, Prompter: prompter, Printer: output})
+	if err != nil {
+		t.Fatalf("failed to create console: %v", err)
+	}
+	return &tester{console: console, prompter: prompter, output: output, datadir: datadir}
+}
+
+func TestWelcome(t *testing.T) {
+	tester := newTester(t)
+	tester.console.Welcome()
+	if output := tester.output.String(); !strings.Contains(output, "test:1.0") || !strings.Contains(output, "rpc:1.0") {
+		t.Errorf("modules missing from welcome: %q", output)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tester := newTester(t)
+
+	tester.console.Evaluate(`test.echo("hello", 3)`)
+	if output := tester.output.String(); output != "{\n  \"n\": 3,\n  \"str\": \"hello\"\n}\n" {
+		t.Errorf("result mismatch: have %q", output)
+	}
+	tester.output.Reset()
+	tester.console.Evaluate("test.empty")
+	if output := tester.output.String(); output != "\"empty\"\n" {
+		t.Errorf("result mismatch: have %q", output)
+	}
+	tester.output.Reset()
+	tester.console.Evaluate("test")
+	if output := tester.output.String(); output != "test.echo\ntest.empty\n" {
+		t.Errorf("methods mismatch: have %q", output)
+	}
+	for _, statement := range []string{"test.echo(", "test.", "test.echo(hello)", "test.missing()"} {
+		tester.output.Reset()
+		tester.console.Evaluate(statement)
+		if output := tester.output.String(); !strings.HasPrefix(output, "Error: ") {
+			t.Errorf("%q: expected error, have %q", statement, output)
+		}
+	}
+}
+
+func TestAutoComplete(t *testing.T) {
+	tester := newTester(t)
+	completer := tester.prompter.completer
+	if completer == nil {
+		t.Fatal("word completer not set")
+	}
+
+	tests := []struct {
+		line        string
+		pos         int
+		head, tail  string
+		completions []string
+	}{
+		{"te", 2, "", "", []string{"test."}},
+		{"test.e", 6, "", "", []string{"test.echo", "test.empty"}},
+		{"test.ec(1)", 7, "", "(1)", []string{"test.echo"}},
+		{"ex", 2, "", "", []string{"exit"}},
+		{"x", 1, "", "", nil},
+	}
+	for _, tt := range tests {
+		head, completions, tail := completer(tt.line, tt.pos)
+		if head != tt.head || tail != tt.tail || strings.Join(completions, ",") != strings.Join(tt.completions, ",") {
+			t.Errorf("%q: have (%q, %v, %q), want (%q, %v, %q)", tt.line, head, completions, tail, tt.head, tt.completions, tt.tail)
+		}
+	}
+}
+
+func TestInteractiveHistory(t *testing.T) {
+	tester := newTester(t, "test.empty()", "test.empty()", "modules", "exit", "test.empty()")
+	tester.console.Interactive()
+	if len(tester.prompter.inputs) != 1 {
+		t.Errorf("console did not exit on exit command, remaining inputs %v", tester.prompter.inputs)
+	}
+	if err := tester.console.Stop(); err != nil {
+		t.Fatalf("failed to stop console: %v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(tester.datadir, HistoryFile))
+	if err != nil {
+		t.Fatalf("failed to read history: %v", err)
+	}
+	if have, want := string(content), "test.empty()\nmodules\nexit"; have != want {
+		t.Errorf("history mismatch: have %q, want %q", have, want)
+	}
+}
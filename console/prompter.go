@@ -0,0 +1,59 @@
+package console
+
+import (
+	"github.com/peterh/liner"
+)
+
+// UserPrompter 是控制台读取用户输入的接口, 测试时可以替换为非交互的实现
+type UserPrompter interface {
+	// 显示 prompt 并读取一行输入, 用户按下 Ctrl-C 时返回 liner.ErrPromptAborted
+	PromptInput(prompt string) (string, error)
+
+	// 设置初始的历史记录
+	SetHistory(history []string)
+
+	// 追加一条历史记录
+	AppendHistory(command string)
+
+	// 设置 tab 补全的回调
+	SetWordCompleter(completer WordCompleter)
+
+	// 恢复终端的状态
+	Close() error
+}
+
+// WordCompleter 返回光标所在单词的补全候选, head 和 tail 是单词前后保持不变的部分
+type WordCompleter func(line string, pos int) (head string, completions []string, tail string)
+
+// terminalPrompter 基于 liner 实现, 支持行编辑, 历史记录和 tab 补全
+type terminalPrompter struct {
+	*liner.State
+}
+
+// NewTerminalPrompter 创建读取标准输入的 UserPrompter
+func NewTerminalPrompter() UserPrompter {
+	state := liner.NewLiner()
+	state.SetCtrlCAborts(true)
+	state.SetTabCompletionStyle(liner.TabPrints)
+	state.SetMultiLineMode(true)
+	return &terminalPrompter{state}
+}
+
+func (p *terminalPrompter) PromptInput(prompt string) (string, error) {
+	return p.Prompt(prompt)
+}
+
+func (p *terminalPrompter) SetHistory(history []string) {
+	p.ClearHistory()
+	for _, command := range history {
+		p.State.AppendHistory(command)
+	}
+}
+
+func (p *terminalPrompter) AppendHistory(command string) {
+	p.State.AppendHistory(command)
+}
+
+func (p *terminalPrompter) SetWordCompleter(completer WordCompleter) {
+	p.State.SetWordCompleter(liner.WordCompleter(completer))
+}
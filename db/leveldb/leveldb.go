@@ -73,6 +73,15 @@ func (db *Database) Close() error {
 	return db.db.Close()
 }
 
+// 读取 leveldb 的内部状态, 如 "leveldb.stats"
+func (db *Database) Stat(property string) (string, error) {
+	return db.db.GetProperty(property)
+}
+
+func (db *Database) Compact(start []byte, limit []byte) error {
+	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
+}
+
 func (db *Database) NewBatch() chaindb.Batch {
 	return &batch{
 		db: db.db,
@@ -9,8 +9,10 @@ require (
 	github.com/coreos/go-semver v0.3.0
 	github.com/go-stack/stack v1.8.0
 	github.com/gogo/protobuf v1.3.1
+	github.com/golang/snappy v0.0.1
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/websocket v1.4.1
+	github.com/graph-gophers/graphql-go v1.3.0
 	github.com/hashicorp/golang-lru v0.5.3
 	github.com/huin/goupnp v1.0.0
 	github.com/ipfs/go-cid v0.0.3
@@ -31,6 +33,7 @@ require (
 	github.com/libp2p/go-libp2p v0.3.1
 	github.com/libp2p/go-libp2p-autonat v0.1.0
 	github.com/libp2p/go-libp2p-circuit v0.1.3
+	github.com/libp2p/go-libp2p-connmgr v0.1.1
 	github.com/libp2p/go-libp2p-core v0.2.3
 	github.com/libp2p/go-libp2p-discovery v0.1.0
 	github.com/libp2p/go-libp2p-kad-dht v0.0.0-20191022103404-9c020873aceb
@@ -72,6 +75,7 @@ require (
 	github.com/naoina/go-stringutil v0.1.0
 	github.com/naoina/toml v0.0.0-20170918210437-9fafd6967416
 	github.com/opentracing/opentracing-go v1.1.0
+	github.com/peterh/liner v1.1.0
 	github.com/pkg/errors v0.8.1
 	github.com/spacemonkeygo/spacelog v0.0.0-20180420211403-2296661a0572
 	github.com/spaolacci/murmur3 v1.1.0
@@ -91,5 +95,6 @@ require (
 	go.uber.org/multierr v1.2.0
 	go.uber.org/zap v1.11.0
 	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
+	golang.org/x/sys v0.0.0-20190922100055-0a153f010e69
 	google.golang.org/appengine v1.4.0 // indirect
 )
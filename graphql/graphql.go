@@ -0,0 +1,427 @@
+// graphql 包提供以 GraphQL 查询区块, 交易, 账户和日志的接口
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/proton/chaindb"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/rawdb"
+	"github.com/czh0526/perception/proton/core/state"
+	"github.com/czh0526/perception/proton/core/types"
+)
+
+var (
+	errBlockNotFound   = errors.New("block not found")
+	errBlockInvariant  = errors.New("block objects must be instantiated with at least one of number or hash")
+	errInvalidBlockRng = errors.New("invalid block range")
+)
+
+// Backend 是 GraphQL 查询所需的链上数据
+type Backend interface {
+	BlockChain() *core.BlockChain
+	TxPool() *core.TxPool
+	ChainDb() chaindb.Database
+}
+
+// Account 是账户在某个区块状态下的数据
+type Account struct {
+	backend Backend
+	address common.Address
+	root    common.Hash // 区块的 state root
+}
+
+func (a *Account) getState() (*state.StateDB, error) {
+	return a.backend.BlockChain().StateAt(a.root)
+}
+
+func (a *Account) Address(ctx context.Context) (common.Address, error) {
+	return a.address, nil
+}
+
+func (a *Account) Balance(ctx context.Context) (hexutil.Big, error) {
+	statedb, err := a.getState()
+	if err != nil {
+		return hexutil.Big{}, err
+	}
+	return hexutil.Big(*statedb.GetBalance(a.address)), nil
+}
+
+func (a *Account) TransactionCount(ctx context.Context) (hexutil.Uint64, error) {
+	statedb, err := a.getState()
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(statedb.GetNonce(a.address)), nil
+}
+
+func (a *Account) Code(ctx context.Context) (hexutil.Bytes, error) {
+	statedb, err := a.getState()
+	if err != nil {
+		return hexutil.Bytes{}, err
+	}
+	return hexutil.Bytes(statedb.GetCode(a.address)), nil
+}
+
+func (a *Account) Storage(ctx context.Context, args struct{ Slot common.Hash }) (common.Hash, error) {
+	statedb, err := a.getState()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return statedb.GetState(a.address, args.Slot), nil
+}
+
+// Log 是交易执行过程中产生的事件记录
+type Log struct {
+	backend     Backend
+	transaction *Transaction
+	log         *types.Log
+}
+
+func (l *Log) Transaction(ctx context.Context) *Transaction {
+	return l.transaction
+}
+
+// 账户默认为日志所在区块状态下的数据
+func (l *Log) Account(ctx context.Context, args BlockNumberArgs) (*Account, error) {
+	number := l.log.BlockNumber
+	if args.Block != nil {
+		number = uint64(*args.Block)
+	}
+	header := l.backend.BlockChain().GetHeaderByNumber(number)
+	if header == nil {
+		return nil, errBlockNotFound
+	}
+	return &Account{backend: l.backend, address: l.log.Address, root: header.Root}, nil
+}
+
+func (l *Log) Index(ctx context.Context) int32 {
+	return int32(l.log.Index)
+}
+
+func (l *Log) Topics(ctx context.Context) []common.Hash {
+	return l.log.Topics
+}
+
+func (l *Log) Data(ctx context.Context) hexutil.Bytes {
+	return hexutil.Bytes(l.log.Data)
+}
+
+// Transaction 是区块中或者交易池中的交易
+type Transaction struct {
+	backend Backend
+	hash    common.Hash
+	tx      *types.Transaction
+	block   *Block
+	index   uint64
+}
+
+// 按哈希加载交易, 先查找 canonical 区块, 再查找交易池
+func (t *Transaction) resolve(ctx context.Context) (*types.Transaction, error) {
+	if t.tx != nil {
+		return t.tx, nil
+	}
+	tx, blockHash, _, index := rawdb.ReadTransaction(t.backend.ChainDb(), t.hash)
+	if tx != nil {
+		t.tx = tx
+		t.block = &Block{backend: t.backend, hash: &blockHash}
+		t.index = index
+		return tx, nil
+	}
+	t.tx = t.backend.TxPool().Get(t.hash)
+	return t.tx, nil
+}
+
+func (t *Transaction) Hash(ctx context.Context) common.Hash {
+	return t.hash
+}
+
+func (t *Transaction) Data(ctx context.Context) (string, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil {
+		return "", err
+	}
+	return tx.Data(), nil
+}
+
+func (t *Transaction) Block(ctx context.Context) (*Block, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	return t.block, nil
+}
+
+func (t *Transaction) Index(ctx context.Context) (*int32, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	if t.block == nil {
+		return nil, nil
+	}
+	index := int32(t.index)
+	return &index, nil
+}
+
+// 目前区块中的交易不会被执行, 所以已打包交易的状态总是 1
+func (t *Transaction) Status(ctx context.Context) (*hexutil.Uint64, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	if t.block == nil {
+		return nil, nil
+	}
+	status := hexutil.Uint64(1)
+	return &status, nil
+}
+
+// 目前区块中的交易不会被执行, 所以已打包的交易不会产生日志
+func (t *Transaction) Logs(ctx context.Context) (*[]*Log, error) {
+	if _, err := t.resolve(ctx); err != nil {
+		return nil, err
+	}
+	if t.block == nil {
+		return nil, nil
+	}
+	logs := []*Log{}
+	return &logs, nil
+}
+
+// Block 是 canonical 链上的区块, number 和 hash 至少指定一个, 区块在首次访问时加载
+type Block struct {
+	backend Backend
+	number  *uint64
+	hash    *common.Hash
+	block   *types.Block
+}
+
+func (b *Block) resolve(ctx context.Context) (*types.Block, error) {
+	if b.block != nil {
+		return b.block, nil
+	}
+	bc := b.backend.BlockChain()
+	switch {
+	case b.hash != nil:
+		b.block = bc.GetBlockByHash(*b.hash)
+	case b.number != nil:
+		b.block = bc.GetBlockByNumber(*b.number)
+	default:
+		return nil, errBlockInvariant
+	}
+	if b.block == nil {
+		return nil, errBlockNotFound
+	}
+	return b.block, nil
+}
+
+func (b *Block) Number(ctx context.Context) (hexutil.Uint64, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(block.NumberU64()), nil
+}
+
+func (b *Block) Hash(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.Hash(), nil
+}
+
+func (b *Block) Parent(ctx context.Context) (*Block, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if block.NumberU64() == 0 {
+		return nil, nil
+	}
+	parentHash := block.ParentHash()
+	return &Block{backend: b.backend, hash: &parentHash}, nil
+}
+
+func (b *Block) StateRoot(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.Root(), nil
+}
+
+func (b *Block) TransactionsRoot(ctx context.Context) (common.Hash, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.TxHash(), nil
+}
+
+func (b *Block) Timestamp(ctx context.Context) (hexutil.Uint64, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(block.Time()), nil
+}
+
+func (b *Block) TransactionCount(ctx context.Context) (int32, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int32(len(block.Transactions())), nil
+}
+
+func (b *Block) Transactions(ctx context.Context) ([]*Transaction, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*Transaction, 0, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		txs = append(txs, &Transaction{
+			backend: b.backend,
+			hash:    tx.Hash(),
+			tx:      tx,
+			block:   b,
+			index:   uint64(i),
+		})
+	}
+	return txs, nil
+}
+
+func (b *Block) TransactionAt(ctx context.Context, args struct{ Index int32 }) (*Transaction, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if args.Index < 0 || int(args.Index) >= len(txs) {
+		return nil, nil
+	}
+	tx := txs[args.Index]
+	return &Transaction{
+		backend: b.backend,
+		hash:    tx.Hash(),
+		tx:      tx,
+		block:   b,
+		index:   uint64(args.Index),
+	}, nil
+}
+
+func (b *Block) Account(ctx context.Context, args struct{ Address common.Address }) (*Account, error) {
+	block, err := b.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{backend: b.backend, address: args.Address, root: block.Root()}, nil
+}
+
+// BlockNumberArgs 是可选的区块编号参数, 为空时表示当前链头
+type BlockNumberArgs struct {
+	Block *hexutil.Uint64
+}
+
+// FilterCriteria 是 logs 查询的过滤条件
+type FilterCriteria struct {
+	FromBlock *hexutil.Uint64
+	ToBlock   *hexutil.Uint64
+	Addresses *[]common.Address
+	Topics    *[][]common.Hash
+}
+
+// Resolver 是 GraphQL 查询的根
+type Resolver struct {
+	backend Backend
+}
+
+func (r *Resolver) Block(ctx context.Context, args struct {
+	Number *hexutil.Uint64
+	Hash   *common.Hash
+}) (*Block, error) {
+	var block *Block
+	switch {
+	case args.Number != nil:
+		number := uint64(*args.Number)
+		block = &Block{backend: r.backend, number: &number}
+	case args.Hash != nil:
+		block = &Block{backend: r.backend, hash: args.Hash}
+	default:
+		number := r.backend.BlockChain().CurrentBlock().NumberU64()
+		block = &Block{backend: r.backend, number: &number}
+	}
+	// 区块不存在时返回 null
+	if _, err := block.resolve(ctx); err == errBlockNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (r *Resolver) Blocks(ctx context.Context, args struct {
+	From hexutil.Uint64
+	To   *hexutil.Uint64
+}) ([]*Block, error) {
+	from := uint64(args.From)
+	to := r.backend.BlockChain().CurrentBlock().NumberU64()
+	if args.To != nil && uint64(*args.To) < to {
+		to = uint64(*args.To)
+	}
+	if args.To != nil && uint64(*args.To) < from {
+		return nil, errInvalidBlockRng
+	}
+	var blocks []*Block
+	for i := from; i <= to; i++ {
+		number := i
+		blocks = append(blocks, &Block{backend: r.backend, number: &number})
+	}
+	return blocks, nil
+}
+
+func (r *Resolver) Transaction(ctx context.Context, args struct{ Hash common.Hash }) (*Transaction, error) {
+	tx := &Transaction{backend: r.backend, hash: args.Hash}
+	// 交易不存在时返回 null
+	if t, err := tx.resolve(ctx); err != nil {
+		return nil, err
+	} else if t == nil {
+		return nil, nil
+	}
+	return tx, nil
+}
+
+func (r *Resolver) Account(ctx context.Context, args struct {
+	Address common.Address
+	Block   *hexutil.Uint64
+}) (*Account, error) {
+	bc := r.backend.BlockChain()
+	header := bc.CurrentBlock().Header()
+	if args.Block != nil {
+		if header = bc.GetHeaderByNumber(uint64(*args.Block)); header == nil {
+			return nil, fmt.Errorf("block #%d not found", *args.Block)
+		}
+	}
+	return &Account{backend: r.backend, address: args.Address, root: header.Root}, nil
+}
+
+// Logs 返回满足过滤条件的日志.
+// 目前区块中的交易不会被执行, 链上没有日志, 所以只校验区块范围并返回空列表.
+func (r *Resolver) Logs(ctx context.Context, args struct{ Filter FilterCriteria }) ([]*Log, error) {
+	head := r.backend.BlockChain().CurrentBlock().NumberU64()
+	from, to := head, head
+	if args.Filter.FromBlock != nil {
+		from = uint64(*args.Filter.FromBlock)
+	}
+	if args.Filter.ToBlock != nil {
+		to = uint64(*args.Filter.ToBlock)
+	}
+	if from > to {
+		return nil, errInvalidBlockRng
+	}
+	return []*Log{}, nil
+}
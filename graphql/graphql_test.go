@@ -0,0 +1,138 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/proton/chaindb"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/rawdb"
+	"github.com/czh0526/perception/proton/core/types"
+)
+
+var testAddr = common.BytesToAddress([]byte{1})
+
+type testBackend struct {
+	db     chaindb.Database
+	chain  *core.BlockChain
+	txPool *core.TxPool
+}
+
+func (b *testBackend) BlockChain() *core.BlockChain { return b.chain }
+func (b *testBackend) TxPool() *core.TxPool         { return b.txPool }
+func (b *testBackend) ChainDb() chaindb.Database    { return b.db }
+
+// 构建包含 n 个区块的链, 第一个区块中包含一笔交易
+func newTestBackend(t *testing.T, n int) (*testBackend, []*types.Block) {
+	gspec := &core.Genesis{Alloc: core.GenesisAlloc{
+		testAddr: {
+			Balance: big.NewInt(1000),
+			Nonce:   3,
+			Storage: map[common.Hash]common.Hash{{0x01}: {0x02}},
+		},
+	}}
+	db := rawdb.NewMemoryDatabase()
+	chain, blocks, err := core.GenerateBlockChain(db, gspec, n, func(i int, b *core.BlockGen) {
+		if i == 0 {
+			b.AddTx(types.NewTransaction("graphql"))
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to generate chain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+
+	return &testBackend{db: db, chain: chain, txPool: core.NewTxPool(chain)}, blocks
+}
+
+func query(t *testing.T, handler http.Handler, q string) map[string]interface{} {
+	body, _ := json.Marshal(map[string]string{"query": q})
+	req := httptest.NewRequest("POST", "/graphql", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp struct {
+		Data   map[string]interface{}
+		Errors []interface{}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if len(resp.Errors) > 0 {
+		t.Fatalf("query %q failed: %v", q, resp.Errors)
+	}
+	return resp.Data
+}
+
+func TestGraphQLBlocks(t *testing.T) {
+	backend, blocks := newTestBackend(t, 3)
+	handler, err := NewHandler(backend)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	data := query(t, handler, `{ block { number hash parent { number } } }`)
+	block := data["block"].(map[string]interface{})
+	if block["number"] != "0x3" || block["hash"] != blocks[3].Hash().Hex() {
+		t.Errorf("head block mismatch: have %v", block)
+	}
+	if parent := block["parent"].(map[string]interface{}); parent["number"] != "0x2" {
+		t.Errorf("parent mismatch: have %v", parent)
+	}
+
+	data = query(t, handler, `{ block(hash: "`+blocks[1].Hash().Hex()+`") { number transactionCount transactions { hash index status } } }`)
+	block = data["block"].(map[string]interface{})
+	txs := block["transactions"].([]interface{})
+	if block["number"] != "0x1" || len(txs) != 1 {
+		t.Fatalf("block by hash mismatch: have %v", block)
+	}
+	tx := txs[0].(map[string]interface{})
+	if tx["hash"] != blocks[1].Transactions()[0].Hash().Hex() || tx["index"] != float64(0) || tx["status"] != "0x1" {
+		t.Errorf("transaction mismatch: have %v", tx)
+	}
+
+	if data = query(t, handler, `{ block(number: 10) { number } }`); data["block"] != nil {
+		t.Errorf("expected null for missing block, have %v", data["block"])
+	}
+
+	data = query(t, handler, `{ blocks(from: 1, to: 10) { number } }`)
+	if list := data["blocks"].([]interface{}); len(list) != 3 {
+		t.Errorf("blocks mismatch: have %v", list)
+	}
+}
+
+func TestGraphQLTransactionAndAccount(t *testing.T) {
+	backend, blocks := newTestBackend(t, 1)
+	handler, err := NewHandler(backend)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	hash := blocks[1].Transactions()[0].Hash()
+	data := query(t, handler, `{ transaction(hash: "`+hash.Hex()+`") { data block { number } logs { index } } }`)
+	tx := data["transaction"].(map[string]interface{})
+	if tx["data"] != "graphql" || tx["block"].(map[string]interface{})["number"] != "0x1" {
+		t.Errorf("transaction mismatch: have %v", tx)
+	}
+	if data = query(t, handler, `{ transaction(hash: "0x`+strings.Repeat("aa", 32)+`") { hash } }`); data["transaction"] != nil {
+		t.Errorf("expected null for missing transaction, have %v", data["transaction"])
+	}
+
+	slot := common.Hash{0x01}
+	data = query(t, handler, `{ account(address: "`+testAddr.Hex()+`", block: 0) { balance transactionCount storage(slot: "`+slot.Hex()+`") } }`)
+	account := data["account"].(map[string]interface{})
+	if account["balance"] != "0x3e8" || account["transactionCount"] != "0x3" || account["storage"] != (common.Hash{0x02}).Hex() {
+		t.Errorf("account mismatch: have %v", account)
+	}
+
+	data = query(t, handler, `{ logs(filter: {fromBlock: 0}) { index } }`)
+	if logs := data["logs"].([]interface{}); len(logs) != 0 {
+		t.Errorf("unexpected logs: %v", logs)
+	}
+}
@@ -0,0 +1,87 @@
+package graphql
+
+const schema string = `
+    # Bytes32 是 32 字节的数据, 以十六进制字符串表示
+    scalar Bytes32
+    # Address 是 20 字节的账户地址, 以十六进制字符串表示
+    scalar Address
+    # Bytes 是任意长度的数据, 以十六进制字符串表示
+    scalar Bytes
+    # BigInt 是大整数, 以十六进制字符串表示
+    scalar BigInt
+    # Long 是 64 位无符号整数
+    scalar Long
+
+    schema {
+        query: Query
+    }
+
+    # Account 是账户在某个区块状态下的数据
+    type Account {
+        address: Address!
+        balance: BigInt!
+        # 账户的 nonce
+        transactionCount: Long!
+        code: Bytes!
+        storage(slot: Bytes32!): Bytes32!
+    }
+
+    # Log 是交易执行过程中产生的事件记录
+    type Log {
+        index: Int!
+        account(block: Long): Account!
+        topics: [Bytes32!]!
+        data: Bytes!
+        transaction: Transaction!
+    }
+
+    type Transaction {
+        hash: Bytes32!
+        data: String!
+        # 交易在区块中的位置, 尚未打包时为 null
+        index: Int
+        # 交易所在的区块, 尚未打包时为 null
+        block: Block
+        # 交易收据中的状态, 尚未打包时为 null
+        status: Long
+        # 交易产生的日志, 尚未打包时为 null
+        logs: [Log!]
+    }
+
+    type Block {
+        number: Long!
+        hash: Bytes32!
+        parent: Block
+        stateRoot: Bytes32!
+        transactionsRoot: Bytes32!
+        timestamp: Long!
+        transactionCount: Int!
+        transactions: [Transaction!]!
+        transactionAt(index: Int!): Transaction
+        # 账户在本区块状态下的数据
+        account(address: Address!): Account!
+    }
+
+    # FilterCriteria 是 logs 查询的过滤条件
+    input FilterCriteria {
+        # 起始区块, 默认为当前链头
+        fromBlock: Long
+        # 结束区块, 默认为当前链头
+        toBlock: Long
+        # 产生日志的合约地址, 为空时不限制
+        addresses: [Address!]
+        # 每个位置上可接受的主题, 为空时不限制
+        topics: [[Bytes32!]!]
+    }
+
+    type Query {
+        # 按编号或哈希查询区块, 都不指定时返回当前链头
+        block(number: Long, hash: Bytes32): Block
+        # 返回 [from, to] 范围内的区块, to 默认为当前链头
+        blocks(from: Long!, to: Long): [Block!]!
+        transaction(hash: Bytes32!): Transaction
+        # 查询账户在指定区块状态下的数据, block 默认为当前链头
+        account(address: Address!, block: Long): Account!
+        logs(filter: FilterCriteria!): [Log!]!
+    }
+`
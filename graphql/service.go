@@ -0,0 +1,49 @@
+package graphql
+
+import (
+	"errors"
+	"log"
+
+	"github.com/czh0526/perception/node"
+	"github.com/czh0526/perception/p2p"
+	"github.com/czh0526/perception/rpc"
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+// GraphQL handler 挂载在 HTTP-RPC 服务上的路径
+const Path = "/graphql"
+
+// Service 将 GraphQL handler 挂载在 node 的 HTTP-RPC 服务上, 自身不提供协议和 RPC 接口
+type Service struct{}
+
+// New 解析 schema, 并将 handler 注册到 node 的 HTTP-RPC 服务上
+func New(ctx *node.ServiceContext, backend Backend) (*Service, error) {
+	if !ctx.HTTPEnabled() {
+		return nil, errors.New("GraphQL requires the HTTP-RPC server to be enabled")
+	}
+	handler, err := NewHandler(backend)
+	if err != nil {
+		return nil, err
+	}
+	ctx.RegisterHTTPHandler(Path, handler)
+	log.Printf("GraphQL handler registered, path = %s", Path)
+	return &Service{}, nil
+}
+
+// NewHandler 构建处理 GraphQL 查询的 http.Handler
+func NewHandler(backend Backend) (*relay.Handler, error) {
+	s, err := graphqlgo.ParseSchema(schema, &Resolver{backend})
+	if err != nil {
+		return nil, err
+	}
+	return &relay.Handler{Schema: s}, nil
+}
+
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+func (s *Service) APIs() []rpc.API { return nil }
+
+func (s *Service) Start(server *p2p.Server) error { return nil }
+
+func (s *Service) Stop() error { return nil }
@@ -0,0 +1,138 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/czh0526/perception/p2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var ErrNodeStopped = errors.New("node not started")
+
+// PrivateAdminAPI 提供节点连接的管理功能, 注册在 admin 命名空间下
+type PrivateAdminAPI struct {
+	node *Node
+}
+
+func NewPrivateAdminAPI(node *Node) *PrivateAdminAPI {
+	return &PrivateAdminAPI{node: node}
+}
+
+// AddPeer 连接 url 指定的节点, 断开后自动重连, url 是包含 /p2p/<id> 的 multiaddr
+func (api *PrivateAdminAPI) AddPeer(url string) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	addrInfo, err := parsePeerAddr(url)
+	if err != nil {
+		return false, err
+	}
+	server.AddPeer(*addrInfo)
+	return true, nil
+}
+
+// RemovePeer 断开与 url 指定的节点的连接并停止重连, url 可以是 multiaddr 或者 peer id
+func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	id, err := parsePeerID(url)
+	if err != nil {
+		return false, err
+	}
+	server.RemovePeer(id)
+	return true, nil
+}
+
+// AddTrustedPeer 将 url 指定的节点加入信任列表, 受信任的节点不会被禁止连接
+func (api *PrivateAdminAPI) AddTrustedPeer(url string) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	addrInfo, err := parsePeerAddr(url)
+	if err != nil {
+		return false, err
+	}
+	server.AddTrustedPeer(*addrInfo)
+	return true, nil
+}
+
+// RemoveTrustedPeer 将 url 指定的节点移出信任列表
+func (api *PrivateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	id, err := parsePeerID(url)
+	if err != nil {
+		return false, err
+	}
+	server.RemoveTrustedPeer(id)
+	return true, nil
+}
+
+// PublicAdminAPI 提供节点连接状态的查询, 注册在 admin 命名空间下
+type PublicAdminAPI struct {
+	node *Node
+}
+
+func NewPublicAdminAPI(node *Node) *PublicAdminAPI {
+	return &PublicAdminAPI{node: node}
+}
+
+// Peers 返回当前连接的全部节点的信息
+func (api *PublicAdminAPI) Peers() ([]*p2p.PeerInfo, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.PeersInfo(), nil
+}
+
+// NodeInfo 返回本地节点的信息
+func (api *PublicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.NodeInfo(), nil
+}
+
+// Traffic 返回全部连接的流量统计, 单个节点的统计包含在 Peers 的结果中
+func (api *PublicAdminAPI) Traffic() (*p2p.TrafficInfo, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.Traffic(), nil
+}
+
+// 解析包含 /p2p/<id> 的 multiaddr
+func parsePeerAddr(url string) (*peer.AddrInfo, error) {
+	maddr, err := ma.NewMultiaddr(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid multiaddr %q: %v", url, err)
+	}
+	addrInfo, err := peer.AddrInfoFromP2pAddr(maddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer address %q: %v", url, err)
+	}
+	return addrInfo, nil
+}
+
+// 解析 multiaddr 或者 peer id
+func parsePeerID(url string) (peer.ID, error) {
+	if addrInfo, err := parsePeerAddr(url); err == nil {
+		return addrInfo.ID, nil
+	}
+	id, err := peer.IDB58Decode(url)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer %q: %v", url, err)
+	}
+	return id, nil
+}
@@ -2,14 +2,21 @@ package node
 
 import (
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/czh0526/perception/p2p"
+	"github.com/czh0526/perception/rpc"
 	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 type Config struct {
@@ -19,6 +26,55 @@ type Config struct {
 	P2P         p2p.Config
 	KeyStoreDir string
 	IPCPath     string
+
+	// HTTP-RPC 服务监听的地址和端口, HTTPHost 为空时不启动 HTTP-RPC
+	HTTPHost         string
+	HTTPPort         int
+	HTTPCors         []string
+	HTTPVirtualHosts []string
+	HTTPModules      []string
+	HTTPTimeouts     rpc.HTTPTimeouts
+
+	// WebSocket-RPC 服务监听的地址和端口, WSHost 为空时不启动 WebSocket-RPC
+	WSHost      string
+	WSPort      int
+	WSOrigins   []string
+	WSModules   []string
+	WSExposeAll bool
+}
+
+// IPC 文件的路径, IPCPath 为空时不启动 IPC
+func (c *Config) IPCEndpoint() string {
+	if c.IPCPath == "" {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		if strings.HasPrefix(c.IPCPath, `\\.\pipe\`) {
+			return c.IPCPath
+		}
+		return `\\.\pipe\` + c.IPCPath
+	}
+	if filepath.Base(c.IPCPath) == c.IPCPath {
+		if c.DataDir == "" {
+			return filepath.Join(os.TempDir(), c.IPCPath)
+		}
+		return filepath.Join(c.DataDir, c.IPCPath)
+	}
+	return c.IPCPath
+}
+
+func (c *Config) HTTPEndpoint() string {
+	if c.HTTPHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.HTTPHost, c.HTTPPort)
+}
+
+func (c *Config) WSEndpoint() string {
+	if c.WSHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.WSHost, c.WSPort)
 }
 
 func (c *Config) NodeKey() crypto.PrivKey {
@@ -74,6 +130,66 @@ func (c *Config) NodeKey() crypto.PrivKey {
 	return key
 }
 
+// 返回 P2P.StaticPeers 以及 static-nodes.json 中的节点
+func (c *Config) StaticPeers() []string {
+	return mergePeers(c.P2P.StaticPeers, c.parsePersistentNodes(datadirStaticNodes))
+}
+
+// 返回 P2P.TrustedPeers 以及 trusted-nodes.json 中的节点
+func (c *Config) TrustedPeers() []string {
+	return mergePeers(c.P2P.TrustedPeers, c.parsePersistentNodes(datadirTrustedNodes))
+}
+
+// 读取实例目录中的节点列表文件, 文件的内容是 multiaddr 的 JSON 数组
+func (c *Config) parsePersistentNodes(file string) []string {
+	if c.DataDir == "" {
+		return nil
+	}
+	path := filepath.Join(c.instanceDir(), file)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read node list %s: %v", path, err)
+		}
+		return nil
+	}
+	var urls []string
+	if err := json.Unmarshal(data, &urls); err != nil {
+		log.Printf("Failed to parse node list %s: %v", path, err)
+		return nil
+	}
+	var nodes []string
+	for _, url := range urls {
+		if url == "" {
+			continue
+		}
+		maddr, err := ma.NewMultiaddr(url)
+		if err != nil {
+			log.Printf("Skip invalid node url %q in %s: %v", url, path, err)
+			continue
+		}
+		if _, err := peer.AddrInfoFromP2pAddr(maddr); err != nil {
+			log.Printf("Skip invalid node url %q in %s: %v", url, path, err)
+			continue
+		}
+		nodes = append(nodes, url)
+	}
+	return nodes
+}
+
+// 合并两个节点列表, 去掉重复的节点
+func mergePeers(a, b []string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, url := range append(append([]string{}, a...), b...) {
+		if !seen[url] {
+			seen[url] = true
+			merged = append(merged, url)
+		}
+	}
+	return merged
+}
+
 func (c *Config) ResolvePath(path string) string {
 	if filepath.IsAbs(path) {
 		return path
@@ -6,13 +6,27 @@ import (
 	"path/filepath"
 
 	"github.com/czh0526/perception/p2p"
+	"github.com/czh0526/perception/rpc"
+)
+
+const (
+	DefaultHTTPHost = "localhost"
+	DefaultHTTPPort = 8545
+	DefaultWSHost   = "localhost"
+	DefaultWSPort   = 8546
 )
 
 var DefaultConfig = Config{
-	Name:    "perception",
-	Version: "0.0.1",
-	DataDir: DefaultDataDir(),
-	IPCPath: "perception.ipc",
+	Name:             "perception",
+	Version:          "0.0.1",
+	DataDir:          DefaultDataDir(),
+	IPCPath:          "perception.ipc",
+	HTTPPort:         DefaultHTTPPort,
+	HTTPModules:      []string{"proton"},
+	HTTPVirtualHosts: []string{"localhost"},
+	HTTPTimeouts:     rpc.DefaultHTTPTimeouts,
+	WSPort:           DefaultWSPort,
+	WSModules:        []string{"proton"},
 	P2P: p2p.Config{
 		Name:       "perception",
 		ListenAddr: "/ip4/0.0.0.0/tcp/10000",
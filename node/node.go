@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -13,12 +15,15 @@ import (
 	"github.com/czh0526/perception/proton/core/rawdb"
 
 	"github.com/czh0526/perception/p2p"
+	"github.com/czh0526/perception/rpc"
 )
 
 const (
 	datadirPrivateKey      = "nodekey"
 	datadirDefaultKeyStore = "keystore"
 	datadirNodeDatabase    = "nodes"
+	datadirStaticNodes     = "static-nodes.json"  // 一直保持连接的节点
+	datadirTrustedNodes    = "trusted-nodes.json" // 不受 MaxPeers 限制的节点
 )
 
 type Node struct {
@@ -28,6 +33,22 @@ type Node struct {
 	serviceFuncs []ServiceConstructor
 	services     map[reflect.Type]Service
 
+	rpcAPIs       []rpc.API
+	inprocHandler *rpc.Server
+
+	ipcEndpoint string
+	ipcListener net.Listener
+	ipcHandler  *rpc.Server
+
+	httpEndpoint string
+	httpListener net.Listener
+	httpHandler  *rpc.Server
+	httpHandlers map[string]http.Handler // service 注册的额外 HTTP handler
+
+	wsEndpoint string
+	wsListener net.Listener
+	wsHandler  *rpc.Server
+
 	stop chan struct{}
 	lock sync.RWMutex
 }
@@ -52,7 +73,10 @@ func New(conf *Config) (*Node, error) {
 	}
 
 	return &Node{
-		config: conf,
+		config:       conf,
+		ipcEndpoint:  conf.IPCEndpoint(),
+		httpEndpoint: conf.HTTPEndpoint(),
+		wsEndpoint:   conf.WSEndpoint(),
 	}, nil
 }
 
@@ -74,13 +98,24 @@ func (n *Node) Start() error {
 	var p2pConfig = &n.config.P2P
 	p2pConfig.PrivateKey = n.config.NodeKey()
 	p2pConfig.Name = "Sweet Windy"
+	p2pConfig.StaticPeers = n.config.StaticPeers()
+	p2pConfig.TrustedPeers = n.config.TrustedPeers()
+	if n.config.DataDir != "" {
+		p2pConfig.NodeDatabase = n.config.ResolvePath(datadirNodeDatabase)
+	}
 	running := p2p.NewServer(p2pConfig)
 
 	// 构建 service 列表
 	services := make(map[reflect.Type]Service)
+	handlers := make(map[string]http.Handler)
 	for _, constructor := range n.serviceFuncs {
 		ctx := &ServiceContext{
-			config: n.config,
+			config:   n.config,
+			services: make(map[reflect.Type]Service),
+			handlers: handlers,
+		}
+		for kind, s := range services {
+			ctx.services[kind] = s
 		}
 		service, err := constructor(ctx)
 		if err != nil {
@@ -111,6 +146,16 @@ func (n *Node) Start() error {
 		}
 	}
 
+	// 启动 RPC 服务
+	n.httpHandlers = handlers
+	if err := n.startRPC(services); err != nil {
+		for _, service := range services {
+			service.Stop()
+		}
+		running.Stop()
+		return err
+	}
+
 	n.services = services
 	n.server = running
 	n.stop = make(chan struct{})
@@ -125,6 +170,9 @@ func (n *Node) Stop() error {
 		return errors.New("Node has stopped.")
 	}
 
+	// 停止 RPC 服务
+	n.stopRPC()
+
 	// 停止服务模块
 	for kind, service := range n.services {
 		if err := service.Stop(); err != nil {
@@ -141,6 +189,219 @@ func (n *Node) Stop() error {
 	return nil
 }
 
+// 启动 inproc, IPC, HTTP 和 WebSocket 四种 RPC 服务, 任何一个失败都会关闭已经启动的服务
+func (n *Node) startRPC(services map[reflect.Type]Service) error {
+	apis := n.apis()
+	for _, service := range services {
+		apis = append(apis, service.APIs()...)
+	}
+
+	if err := n.startInProc(apis); err != nil {
+		return err
+	}
+	if err := n.startIPC(apis); err != nil {
+		n.stopInProc()
+		return err
+	}
+	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts, n.config.HTTPTimeouts, n.httpHandlers); err != nil {
+		n.stopIPC()
+		n.stopInProc()
+		return err
+	}
+	if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll); err != nil {
+		n.stopHTTP()
+		n.stopIPC()
+		n.stopInProc()
+		return err
+	}
+
+	n.rpcAPIs = apis
+	return nil
+}
+
+func (n *Node) stopRPC() {
+	n.stopWS()
+	n.stopHTTP()
+	n.stopIPC()
+	n.stopInProc()
+	n.rpcAPIs = nil
+}
+
+func (n *Node) startInProc(apis []rpc.API) error {
+	handler := rpc.NewServer()
+	for _, api := range apis {
+		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+			return err
+		}
+	}
+	n.inprocHandler = handler
+	return nil
+}
+
+func (n *Node) stopInProc() {
+	if n.inprocHandler != nil {
+		n.inprocHandler.Stop()
+		n.inprocHandler = nil
+	}
+}
+
+func (n *Node) startIPC(apis []rpc.API) error {
+	if n.ipcEndpoint == "" {
+		return nil
+	}
+	listener, handler, err := rpc.StartIPCEndpoint(n.ipcEndpoint, apis)
+	if err != nil {
+		return err
+	}
+	n.ipcListener = listener
+	n.ipcHandler = handler
+	log.Printf("IPC endpoint opened, url = %s", n.ipcEndpoint)
+	return nil
+}
+
+func (n *Node) stopIPC() {
+	if n.ipcListener != nil {
+		n.ipcListener.Close()
+		n.ipcListener = nil
+		log.Printf("IPC endpoint closed, url = %s", n.ipcEndpoint)
+	}
+	if n.ipcHandler != nil {
+		n.ipcHandler.Stop()
+		n.ipcHandler = nil
+	}
+}
+
+func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string, timeouts rpc.HTTPTimeouts, handlers map[string]http.Handler) error {
+	if endpoint == "" {
+		return nil
+	}
+	listener, handler, err := rpc.StartHTTPEndpoint(endpoint, apis, modules, cors, vhosts, timeouts, handlers)
+	if err != nil {
+		return err
+	}
+	log.Printf("HTTP endpoint opened, url = http://%s, cors = %s, vhosts = %s",
+		listener.Addr(), strings.Join(cors, ","), strings.Join(vhosts, ","))
+	n.httpEndpoint = endpoint
+	n.httpListener = listener
+	n.httpHandler = handler
+	return nil
+}
+
+func (n *Node) stopHTTP() {
+	if n.httpListener != nil {
+		n.httpListener.Close()
+		n.httpListener = nil
+		log.Printf("HTTP endpoint closed, url = http://%s", n.httpEndpoint)
+	}
+	if n.httpHandler != nil {
+		n.httpHandler.Stop()
+		n.httpHandler = nil
+	}
+}
+
+func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrigins []string, exposeAll bool) error {
+	if endpoint == "" {
+		return nil
+	}
+	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll)
+	if err != nil {
+		return err
+	}
+	log.Printf("WebSocket endpoint opened, url = ws://%s", listener.Addr())
+	n.wsEndpoint = endpoint
+	n.wsListener = listener
+	n.wsHandler = handler
+	return nil
+}
+
+func (n *Node) stopWS() {
+	if n.wsListener != nil {
+		n.wsListener.Close()
+		n.wsListener = nil
+		log.Printf("WebSocket endpoint closed, url = ws://%s", n.wsEndpoint)
+	}
+	if n.wsHandler != nil {
+		n.wsHandler.Stop()
+		n.wsHandler = nil
+	}
+}
+
+// node 自身提供的 API
+func (n *Node) apis() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "admin",
+			Version:   "1.0",
+			Service:   NewPrivateAdminAPI(n),
+		},
+		{
+			Namespace: "admin",
+			Version:   "1.0",
+			Service:   NewPublicAdminAPI(n),
+			Public:    true,
+		},
+	}
+}
+
+// 返回正在运行的 p2p server, 节点未启动时返回 nil
+func (n *Node) Server() *p2p.Server {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	return n.server
+}
+
+// 返回进程内的 RPC handler, 用于 attach 到本节点
+func (n *Node) InProcHandler() *rpc.Server {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	return n.inprocHandler
+}
+
+// 创建连接到本节点的进程内 RPC client
+func (n *Node) Attach() (*rpc.Client, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	if n.inprocHandler == nil {
+		return nil, ErrNodeStopped
+	}
+	return rpc.DialInProc(n.inprocHandler), nil
+}
+
+// 节点的数据目录
+func (n *Node) DataDir() string {
+	return n.config.DataDir
+}
+
+// IPC 文件的路径
+func (n *Node) IPCEndpoint() string {
+	return n.ipcEndpoint
+}
+
+// HTTP-RPC 服务监听的地址
+func (n *Node) HTTPEndpoint() string {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	if n.httpListener != nil {
+		return n.httpListener.Addr().String()
+	}
+	return n.httpEndpoint
+}
+
+// WebSocket-RPC 服务监听的地址
+func (n *Node) WSEndpoint() string {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	if n.wsListener != nil {
+		return n.wsListener.Addr().String()
+	}
+	return n.wsEndpoint
+}
+
 func (n *Node) Wait() {
 	n.lock.RLock()
 	stop := n.stop
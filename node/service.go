@@ -2,14 +2,19 @@ package node
 
 import (
 	"errors"
+	"net/http"
+	"reflect"
 
 	"github.com/czh0526/perception/p2p"
 	"github.com/czh0526/perception/proton/chaindb"
 	"github.com/czh0526/perception/proton/core/rawdb"
+	"github.com/czh0526/perception/rpc"
 )
 
 type ServiceContext struct {
-	config *Config
+	config   *Config
+	services map[reflect.Type]Service // 已经构建的 service, 按注册的顺序
+	handlers map[string]http.Handler  // 挂载在 HTTP-RPC 服务上的额外 handler
 }
 
 func (ctx *ServiceContext) OpenDatabase(name string, cache int, handles int, namespace string) (chaindb.Database, error) {
@@ -22,8 +27,31 @@ func (ctx *ServiceContext) OpenDatabase(name string, cache int, handles int, nam
 	return rawdb.NewLevelDBDatabase(root, cache, handles, namespace)
 }
 
+var ErrServiceUnknown = errors.New("unknown service")
+
+// 查找已经构建的 service, service 必须是指向 service 类型指针的指针
+func (ctx *ServiceContext) Service(service interface{}) error {
+	element := reflect.ValueOf(service).Elem()
+	if running, ok := ctx.services[element.Type()]; ok {
+		element.Set(reflect.ValueOf(running))
+		return nil
+	}
+	return ErrServiceUnknown
+}
+
+// 将 handler 挂载在 HTTP-RPC 服务的 path 上, HTTP-RPC 服务未开启时不会生效
+func (ctx *ServiceContext) RegisterHTTPHandler(path string, handler http.Handler) {
+	ctx.handlers[path] = handler
+}
+
+// HTTP-RPC 服务是否开启
+func (ctx *ServiceContext) HTTPEnabled() bool {
+	return ctx.config.HTTPEndpoint() != ""
+}
+
 type Service interface {
 	Protocols() []p2p.Protocol
+	APIs() []rpc.API
 	Start(*p2p.Server) error
 	Stop() error
 }
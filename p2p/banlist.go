@@ -0,0 +1,68 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"log"
+	"time"
+
+	"github.com/czh0526/perception/db/leveldb"
+	"github.com/czh0526/perception/db/memorydb"
+	"github.com/czh0526/perception/proton/chaindb"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// 禁止连接的记录在节点数据库中的 key 前缀, key = banPrefix + peer id, value = 解禁时间 (unix 纳秒)
+var banPrefix = []byte("ban-")
+
+// 打开节点数据库, path 为空时使用内存数据库
+func openNodeDB(path string) (chaindb.KeyValueStore, error) {
+	if path == "" {
+		return memorydb.New(), nil
+	}
+	return leveldb.New(path, 0, 0, "")
+}
+
+func banKey(id peer.ID) []byte {
+	return append(append([]byte{}, banPrefix...), []byte(id)...)
+}
+
+// 读取尚未到期的禁止连接记录, 同时删除已经到期的记录
+func loadBans(db chaindb.KeyValueStore, now time.Time) map[peer.ID]time.Time {
+	bans := make(map[peer.ID]time.Time)
+	var expired [][]byte
+
+	it := db.NewIteratorWithPrefix(banPrefix)
+	for it.Next() {
+		if len(it.Value()) != 8 {
+			continue
+		}
+		until := time.Unix(0, int64(binary.BigEndian.Uint64(it.Value())))
+		if now.After(until) {
+			expired = append(expired, append([]byte{}, it.Key()...))
+			continue
+		}
+		bans[peer.ID(it.Key()[len(banPrefix):])] = until
+	}
+	it.Release()
+
+	for _, key := range expired {
+		db.Delete(key)
+	}
+	return bans
+}
+
+// 保存节点的解禁时间
+func storeBan(db chaindb.KeyValueStore, id peer.ID, until time.Time) {
+	var value [8]byte
+	binary.BigEndian.PutUint64(value[:], uint64(until.UnixNano()))
+	if err := db.Put(banKey(id), value[:]); err != nil {
+		log.Printf("p2p server store ban of <%v> error: %v", id, err)
+	}
+}
+
+// 删除节点的禁止连接记录
+func deleteBan(db chaindb.KeyValueStore, id peer.ID) {
+	if err := db.Delete(banKey(id)); err != nil {
+		log.Printf("p2p server delete ban of <%v> error: %v", id, err)
+	}
+}
@@ -5,9 +5,47 @@ import (
 )
 
 type Config struct {
-	Name           string
-	PrivateKey     crypto.PrivKey `toml:"-"`
-	MaxPeers       int
+	Name       string
+	PrivateKey crypto.PrivKey `toml:"-"`
+
+	// 最多同时连接的节点数, 受信任的节点不计入
+	MaxPeers int
+
+	// 主动连接的节点最多占 MaxPeers 的 1/DialRatio, 其余槽位留给对端发起的连接.
+	// 为 0 时使用 defaultDialRatio.
+	DialRatio int `toml:",omitempty"`
+
+	// 节点数据库的路径, 保存禁止连接的记录. 为空时只保存在内存中.
+	NodeDatabase string `toml:",omitempty"`
+
 	ListenAddr     string
 	BootstrapPeers []string
+
+	// 不通过 DHT 公布自己和查找节点, 只连接 bootnodes, static 节点和 mDNS 发现的节点
+	NoDiscovery bool `toml:",omitempty"`
+
+	// 通过 mDNS 在局域网中公布自己并查找节点, 不需要 bootnode
+	MDNS bool `toml:",omitempty"`
+
+	// 通过 UPnP 或者 NAT-PMP 在路由器上映射监听端口
+	NAT bool `toml:",omitempty"`
+
+	// 额外公布的外部地址 (不包含 /p2p/<id> 的 multiaddr), 例如路由器上手工配置了端口转发时的公网地址
+	ExternalAddrs []string `toml:",omitempty"`
+
+	// 通过 AutoNAT 检测本节点是否可以被公网上的节点访问
+	AutoNAT bool `toml:",omitempty"`
+
+	// circuit relay 的模式: RelayOff, RelayClient 或者 RelayHop. 为空时使用 RelayClient.
+	Relay string `toml:",omitempty"`
+
+	// 位于 NAT 之后时自动寻找中继节点并公布中继地址, Relay 为 RelayHop 时公布自己为中继节点.
+	// 不能与 RelayOff 同时使用.
+	AutoRelay bool `toml:",omitempty"`
+
+	// 一直保持连接的节点, 断开后自动重连. 地址是包含 /p2p/<id> 的 multiaddr.
+	StaticPeers []string `toml:",omitempty"`
+
+	// 受信任的节点, 不受 MaxPeers 的限制, 也不会被禁止连接
+	TrustedPeers []string `toml:",omitempty"`
 }
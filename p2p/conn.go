@@ -3,99 +3,190 @@ package p2p
 import (
 	"bufio"
 	"bytes"
-	"fmt"
+	"encoding/binary"
+	"errors"
 	"io"
 	"log"
+	"net"
 	"sync"
+	"time"
 
-	"github.com/czh0526/perception/rlp"
+	"github.com/golang/snappy"
 	"github.com/libp2p/go-libp2p-core/network"
 )
 
+const (
+	// 消息帧头: 4 字节消息码 + 4 字节消息体在连接上的长度, 均为大端序.
+	// 消息码的最高位表示消息体经过了 snappy 压缩.
+	frameHeaderSize = 8
+	frameCompressed = 1 << 31
+
+	// 双方都支持 snappy 时, 超过该长度的消息体被压缩
+	snappyThreshold = 256
+
+	// 任何消息都不能超过的长度上限
+	maxMsgSize = 16 * 1024 * 1024
+
+	// 协议没有指定 MaxMsgSize 时使用的长度上限
+	defaultMaxMsgSize = 1024 * 1024
+
+	// 等待下一个消息的最长时间, 对端每 pingInterval 发送一次 ping, 超时说明连接已经失效
+	msgIdleTimeout = 3 * pingInterval
+
+	// 读取消息体和写入一个消息的最长时间
+	frameReadTimeout  = 20 * time.Second
+	frameWriteTimeout = 20 * time.Second
+)
+
+// 消息长度超过了所属协议的上限
+var errMsgTooLarge = errors.New("message too large")
+
 type ProtoRW struct {
 	stream   network.Stream
 	rw       *bufio.ReadWriter
 	rmu, wmu sync.Mutex
+
+	// 返回消息码允许的最大长度, 在握手完成之后由 Peer 设置
+	limit func(code uint64) uint32
+
+	// 握手时协商是否压缩消息体, 握手完成之后不再改变
+	snappy bool
 }
 
 func NewProtoRW(stream network.Stream) *ProtoRW {
 	return &ProtoRW{
 		stream: stream,
 		rw:     bufio.NewReadWriter(bufio.NewReader(stream), bufio.NewWriter(stream)),
+		limit:  handshakeMsgLimit,
 	}
 }
 
+// 握手阶段只允许基础协议的消息
+func handshakeMsgLimit(code uint64) uint32 {
+	if code < baseProtocolLength {
+		return baseProtocolMaxMsgSize
+	}
+	return 0
+}
+
 func (c *ProtoRW) Close(err error) {
-	c.wmu.Lock()
-	defer c.wmu.Unlock()
+	// WriteMsg 会获取 wmu, 这里不能持有锁
 	if r, ok := err.(DiscReason); ok && r != DiscNetworkError {
 		SendItems(c, discMsg, r)
-		fmt.Println(`\/`)
-		fmt.Println(`/\`)
 	}
 
 	c.stream.Close()
 }
 
-// 从 stream 中读取并反序列化 Msg
+// 从 stream 中读取一个消息帧, 在分配内存之前检查消息长度.
+// 返回的 Msg.Size 是解压之后的长度.
 func (c *ProtoRW) ReadMsg() (Msg, error) {
 	c.rmu.Lock()
 	defer c.rmu.Unlock()
 
 	msg := Msg{}
-	if err := rlp.Decode(c.rw, &msg.Code); err != nil {
-		return msg, err
+	var header [frameHeaderSize]byte
+	c.stream.SetReadDeadline(time.Now().Add(msgIdleTimeout))
+	if _, err := io.ReadFull(c.rw, header[:]); err != nil {
+		return msg, readError(err)
 	}
+	code := binary.BigEndian.Uint32(header[:4])
+	compressed := code&frameCompressed != 0
+	msg.Code = uint64(code &^ frameCompressed)
+	msg.wireSize = binary.BigEndian.Uint32(header[4:])
 
-	log.Printf("\t\t %v <== [%v] \n", msgType(msg.Code), c.stream.Protocol())
-
-	if err := rlp.Decode(c.rw, &msg.Size); err != nil {
-		return msg, err
+	if compressed && !c.snappy {
+		return msg, errInvalidMsg
+	}
+	limit := c.limit(msg.Code)
+	if limit > maxMsgSize {
+		limit = maxMsgSize
+	}
+	if compressed && msg.wireSize > uint32(snappy.MaxEncodedLen(int(limit))) || !compressed && msg.wireSize > limit {
+		log.Printf("p2p peer sent oversized message: code %d, size %d, limit %d", msg.Code, msg.wireSize, limit)
+		return msg, errMsgTooLarge
 	}
 
-	var payload = make([]byte, msg.Size)
+	var payload = make([]byte, msg.wireSize)
+	c.stream.SetReadDeadline(time.Now().Add(frameReadTimeout))
 	if _, err := io.ReadFull(c.rw, payload); err != nil {
-		return msg, err
+		return msg, readError(err)
+	}
+	msg.Size = msg.wireSize
+
+	if compressed {
+		// 解压之前检查消息体声明的原始长度
+		size, err := snappy.DecodedLen(payload)
+		if err != nil {
+			return msg, errInvalidMsg
+		}
+		if size > int(limit) {
+			log.Printf("p2p peer sent oversized message: code %d, size %d, limit %d", msg.Code, size, limit)
+			return msg, errMsgTooLarge
+		}
+		if payload, err = snappy.Decode(nil, payload); err != nil {
+			return msg, errInvalidMsg
+		}
+		msg.Size = uint32(size)
 	}
 
 	msg.Payload = bytes.NewReader(payload)
 	return msg, nil
 }
 
-// 将 Msg 序列化并写入 stream
+// 将 Msg 编码为消息帧并写入 stream, 协商了 snappy 时压缩较大的消息体
 func (c *ProtoRW) WriteMsg(msg Msg) error {
+	_, err := c.writeMsg(msg)
+	return err
+}
+
+// 写入消息并返回消息体在连接上的长度
+func (c *ProtoRW) writeMsg(msg Msg) (uint32, error) {
 	c.wmu.Lock()
 	defer c.wmu.Unlock()
 
-	log.Printf("\t\t %v ==> [%v] \n", msgType(msg.Code), c.stream.Protocol())
-
-	num := 0
-	ptype, err := rlp.EncodeToBytes(msg.Code)
-	if err != nil {
-		return err
+	if msg.Code >= frameCompressed {
+		return 0, errInvalidMsgCode
 	}
-	written, err := c.rw.Write(ptype)
-	if err != nil {
-		return err
+	if msg.Size > c.limit(msg.Code) || msg.Size > maxMsgSize {
+		return 0, errMsgTooLarge
 	}
-	num += written
 
-	psize, err := rlp.EncodeToBytes(msg.Size)
-	if err != nil {
-		return err
-	}
-	written, err = c.rw.Write(psize)
-	if err != nil {
-		return err
+	code := uint32(msg.Code)
+	payload := msg.Payload
+	msg.wireSize = msg.Size
+	if c.snappy && msg.Size > snappyThreshold {
+		raw := make([]byte, msg.Size)
+		if _, err := io.ReadFull(msg.Payload, raw); err != nil {
+			return 0, err
+		}
+		// 压缩没有减小长度时发送原始数据
+		if encoded := snappy.Encode(nil, raw); len(encoded) < len(raw) {
+			code |= frameCompressed
+			payload, msg.wireSize = bytes.NewReader(encoded), uint32(len(encoded))
+		} else {
+			payload = bytes.NewReader(raw)
+		}
 	}
-	num += written
 
-	copy, err := io.Copy(c.rw, msg.Payload)
-	if err != nil {
-		return err
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], code)
+	binary.BigEndian.PutUint32(header[4:], msg.wireSize)
+
+	c.stream.SetWriteDeadline(time.Now().Add(frameWriteTimeout))
+	if _, err := c.rw.Write(header[:]); err != nil {
+		return 0, err
 	}
-	num += int(copy)
-	c.rw.Flush()
+	if _, err := io.CopyN(c.rw, payload, int64(msg.wireSize)); err != nil {
+		return 0, err
+	}
+	return msg.wireSize, c.rw.Flush()
+}
 
-	return nil
+// 读取超时转换为 DiscReadTimeout
+func readError(err error) error {
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return DiscReadTimeout
+	}
+	return err
 }
@@ -0,0 +1,139 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+func TestProtoRWRoundTrip(t *testing.T) {
+	c1, c2 := net.Pipe()
+	w, r := NewProtoRW(&pipeStream{conn: c1}), NewProtoRW(&pipeStream{conn: c2})
+	defer c1.Close()
+	defer c2.Close()
+
+	go SendItems(w, pingMsg, "ping")
+	msg, err := r.ReadMsg()
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	var data []string
+	if err := msg.Decode(&data); err != nil || msg.Code != pingMsg || len(data) != 1 || data[0] != "ping" {
+		t.Errorf("message mismatch: %v, %v, %v", msg, data, err)
+	}
+
+	// 握手阶段不允许协议消息, 发送端在写入之前拒绝
+	if err := SendItems(w, baseProtocolLength, "data"); err != errMsgTooLarge {
+		t.Errorf("error mismatch: have %v, want %v", err, errMsgTooLarge)
+	}
+}
+
+func TestProtoRWRejectsOversizedFrame(t *testing.T) {
+	c1, c2 := net.Pipe()
+	r := NewProtoRW(&pipeStream{conn: c2})
+	defer c1.Close()
+	defer c2.Close()
+
+	// 只发送帧头, 长度字段声明了超过上限的消息体
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], pingMsg)
+	binary.BigEndian.PutUint32(header[4:], 0xffffffff)
+	go c1.Write(header[:])
+
+	if _, err := r.ReadMsg(); err != errMsgTooLarge {
+		t.Errorf("error mismatch: have %v, want %v", err, errMsgTooLarge)
+	}
+}
+
+func TestProtoRWSnappy(t *testing.T) {
+	c1, c2 := net.Pipe()
+	w, r := NewProtoRW(&pipeStream{conn: c1}), NewProtoRW(&pipeStream{conn: c2})
+	w.snappy, r.snappy = true, true
+	defer c1.Close()
+	defer c2.Close()
+
+	data := bytes.Repeat([]byte{'a'}, baseProtocolMaxMsgSize/2)
+	go Send(w, pingMsg, data)
+	msg, err := r.ReadMsg()
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if msg.wireSize >= msg.Size {
+		t.Errorf("payload not compressed: wire size %d, size %d", msg.wireSize, msg.Size)
+	}
+	var decoded []byte
+	if err := msg.Decode(&decoded); err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("payload mismatch: %v", err)
+	}
+
+	// 压缩之后很小, 但是解压之后超过上限的消息体
+	bomb := snappy.Encode(nil, make([]byte, baseProtocolMaxMsgSize+1))
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], pingMsg|frameCompressed)
+	binary.BigEndian.PutUint32(header[4:], uint32(len(bomb)))
+	go func() {
+		c1.Write(header[:])
+		c1.Write(bomb)
+	}()
+	if _, err := r.ReadMsg(); err != errMsgTooLarge {
+		t.Errorf("error mismatch: have %v, want %v", err, errMsgTooLarge)
+	}
+}
+
+func TestProtoRWUnnegotiatedSnappy(t *testing.T) {
+	c1, c2 := net.Pipe()
+	r := NewProtoRW(&pipeStream{conn: c2})
+	defer c1.Close()
+	defer c2.Close()
+
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], pingMsg|frameCompressed)
+	go c1.Write(header[:])
+	if _, err := r.ReadMsg(); err != errInvalidMsg {
+		t.Errorf("error mismatch: have %v, want %v", err, errInvalidMsg)
+	}
+}
+
+func TestProtoRWPeerLimits(t *testing.T) {
+	protos := []Protocol{
+		{Name: "a", Version: 1, Length: 2, MaxMsgSize: 16},
+		{Name: "b", Version: 1, Length: 1},
+	}
+	p1, _ := newTestPeers(protos)
+	tests := []struct {
+		code  uint64
+		limit uint32
+	}{
+		{pingMsg, baseProtocolMaxMsgSize},
+		{baseProtocolLength, 16},
+		{baseProtocolLength + 1, 16},
+		{baseProtocolLength + 2, defaultMaxMsgSize},
+		{baseProtocolLength + 3, 0},
+	}
+	for _, test := range tests {
+		if limit := p1.msgLimit(test.code); limit != test.limit {
+			t.Errorf("code %d: limit mismatch: have %d, want %d", test.code, limit, test.limit)
+		}
+	}
+
+	big := bytes.Repeat([]byte{1}, 32)
+	if err := Send(p1.running["a"], 0, big); err != errMsgTooLarge {
+		t.Errorf("error mismatch: have %v, want %v", err, errMsgTooLarge)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	c2.SetReadDeadline(time.Now())
+	_, err := c2.Read(make([]byte, 1))
+	if err := readError(err); err != DiscReadTimeout {
+		t.Errorf("error mismatch: have %v, want %v", err, DiscReadTimeout)
+	}
+}
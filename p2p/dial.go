@@ -0,0 +1,197 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// static 节点断开或者拨号失败后, 重新拨号的初始间隔和最大间隔, 每次失败间隔加倍
+	staticDialBackoff    = 5 * time.Second
+	maxStaticDialBackoff = 5 * time.Minute
+
+	// 检查 static 节点是否需要拨号的周期
+	staticDialInterval = time.Second
+)
+
+// staticPeer 是需要保持连接的节点
+type staticPeer struct {
+	addrInfo peer.AddrInfo
+	backoff  time.Duration // 下一次失败后的重拨间隔
+	next     time.Time     // 下一次拨号的时间
+	dialing  bool
+}
+
+// 解析包含 /p2p/<id> 的 multiaddr 列表, 跳过无效的地址
+func parsePeerAddrs(urls []string) []peer.AddrInfo {
+	var addrInfos []peer.AddrInfo
+	for _, url := range urls {
+		maddr, err := ma.NewMultiaddr(url)
+		if err != nil {
+			log.Printf("p2p server skip invalid multiaddr %q: %v", url, err)
+			continue
+		}
+		addrInfo, err := peer.AddrInfoFromP2pAddr(maddr)
+		if err != nil {
+			log.Printf("p2p server skip invalid peer address %q: %v", url, err)
+			continue
+		}
+		addrInfos = append(addrInfos, *addrInfo)
+	}
+	return addrInfos
+}
+
+// 将 Config 中的 static 节点和受信任节点加入列表, 在 Host 创建之后调用
+func (srv *Server) setupPersistentPeers() {
+	for _, addrInfo := range parsePeerAddrs(srv.Config.TrustedPeers) {
+		srv.AddTrustedPeer(addrInfo)
+	}
+	for _, addrInfo := range parsePeerAddrs(srv.Config.StaticPeers) {
+		srv.AddStaticPeer(addrInfo)
+	}
+}
+
+// 将节点加入 static 列表, static 节点会一直保持连接, 断开后自动重连
+func (srv *Server) AddStaticPeer(addrInfo peer.AddrInfo) {
+	if len(addrInfo.Addrs) > 0 {
+		srv.Host.Peerstore().AddAddrs(addrInfo.ID, addrInfo.Addrs, peerstore.PermanentAddrTTL)
+	}
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if _, exists := srv.static[addrInfo.ID]; exists {
+		return
+	}
+	srv.static[addrInfo.ID] = &staticPeer{
+		addrInfo: addrInfo,
+		backoff:  staticDialBackoff,
+	}
+}
+
+// 将节点移出 static 列表, 不会断开已有的连接
+func (srv *Server) RemoveStaticPeer(id peer.ID) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	delete(srv.static, id)
+}
+
+// 返回全部 static 节点的地址
+func (srv *Server) StaticPeers() []peer.AddrInfo {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	addrInfos := make([]peer.AddrInfo, 0, len(srv.static))
+	for _, sp := range srv.static {
+		addrInfos = append(addrInfos, sp.addrInfo)
+	}
+	return addrInfos
+}
+
+// 周期性地拨号尚未连接的 static 节点
+func (srv *Server) staticDialLoop(ctx context.Context) {
+	ticker := time.NewTicker(staticDialInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, addrInfo := range srv.staticDue(time.Now()) {
+				go func(addrInfo peer.AddrInfo) {
+					err := srv.dialPeer(ctx, addrInfo)
+					srv.staticDialDone(addrInfo.ID, err)
+				}(addrInfo)
+			}
+		case <-srv.quit:
+			return
+		}
+	}
+}
+
+// 返回到达拨号时间且尚未连接的 static 节点, 并将其标记为正在拨号
+func (srv *Server) staticDue(now time.Time) []peer.AddrInfo {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	var due []peer.AddrInfo
+	for id, sp := range srv.static {
+		if sp.dialing || srv.Peers[id] != nil || now.Before(sp.next) {
+			continue
+		}
+		if until, banned := srv.banned[id]; banned && now.Before(until) {
+			continue
+		}
+		sp.dialing = true
+		due = append(due, sp.addrInfo)
+	}
+	return due
+}
+
+// 记录 static 节点的拨号结果, 失败时按照 backoff 推迟下一次拨号
+func (srv *Server) staticDialDone(id peer.ID, err error) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	sp := srv.static[id]
+	if sp == nil {
+		return
+	}
+	sp.dialing = false
+	if err == nil {
+		sp.backoff = staticDialBackoff
+		return
+	}
+	log.Printf("p2p server dial static peer <%v> failed, retry in %v: %v", id, sp.backoff, err)
+	srv.scheduleStaticDial(sp)
+}
+
+// 安排 static 节点在 backoff 之后重新拨号, 调用者需要持有 srv.lock
+func (srv *Server) scheduleStaticDial(sp *staticPeer) {
+	sp.next = time.Now().Add(sp.backoff)
+	sp.backoff *= 2
+	if sp.backoff > maxStaticDialBackoff {
+		sp.backoff = maxStaticDialBackoff
+	}
+}
+
+// 节点断开后, 如果是 static 节点则安排重连
+func (srv *Server) staticPeerDropped(id peer.ID) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if sp := srv.static[id]; sp != nil {
+		srv.scheduleStaticDial(sp)
+	}
+}
+
+// 与 addrInfo 建立 perception 连接, 完成握手后启动节点
+func (srv *Server) dialPeer(ctx context.Context, addrInfo peer.AddrInfo) error {
+	if srv.IsBanned(addrInfo.ID) {
+		return fmt.Errorf("peer <%v> is banned", addrInfo.ID)
+	}
+	stream, err := srv.Host.NewStream(ctx, addrInfo.ID, PROTO_PERCEPTION)
+	if err != nil {
+		return fmt.Errorf("establish a stream to <%v> failed: %v", addrInfo.ID, err)
+	}
+	log.Printf("\t new stream ==> %v \n", stream.Conn().RemoteMultiaddr())
+
+	peer, err := createPeer(stream, srv.ourHandshake, srv.Protocols)
+	if err != nil {
+		return fmt.Errorf("create p2p Peer error: %v", err)
+	}
+	// 握手期间槽位可能已经被占用
+	if err := srv.addPeer(peer); err != nil {
+		log.Printf("p2pServer refuse dialed peer <%v>: %v", peer.ID, err)
+		peer.protoRW.Close(err)
+		return err
+	}
+	go srv.runPeer(peer)
+	return nil
+}
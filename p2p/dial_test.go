@@ -0,0 +1,153 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	discovery "github.com/libp2p/go-libp2p-discovery"
+)
+
+func TestStaticPeerBackoff(t *testing.T) {
+	srv := NewServer(&Config{MaxPeers: 3})
+	id := testPeerID(0)
+	srv.AddStaticPeer(peer.AddrInfo{ID: id})
+
+	now := time.Now()
+	if due := srv.staticDue(now); len(due) != 1 || due[0].ID != id {
+		t.Fatalf("static peer not due: %v", due)
+	}
+	// 正在拨号的节点不会被重复拨号
+	if due := srv.staticDue(now); len(due) != 0 {
+		t.Fatalf("static peer dialed twice: %v", due)
+	}
+
+	// 每次失败后重拨间隔加倍, 直到上限
+	want := staticDialBackoff
+	for i := 0; i < 10; i++ {
+		srv.staticDialDone(id, errors.New("dial failed"))
+		sp := srv.static[id]
+		if wait := time.Until(sp.next); wait > want || wait < want-time.Second {
+			t.Fatalf("attempt %d: redial in %v, want %v", i, wait, want)
+		}
+		if due := srv.staticDue(time.Now()); len(due) != 0 {
+			t.Fatalf("attempt %d: static peer due before backoff", i)
+		}
+		due := srv.staticDue(sp.next)
+		if len(due) != 1 {
+			t.Fatalf("attempt %d: static peer not due after backoff", i)
+		}
+		if want *= 2; want > maxStaticDialBackoff {
+			want = maxStaticDialBackoff
+		}
+	}
+
+	// 连接成功后重置间隔, 已连接的节点不会被拨号
+	srv.staticDialDone(id, nil)
+	if srv.static[id].backoff != staticDialBackoff {
+		t.Errorf("backoff not reset: %v", srv.static[id].backoff)
+	}
+	if err := srv.addPeer(&Peer{ID: id}); err != nil {
+		t.Fatalf("failed to add static peer: %v", err)
+	}
+	if due := srv.staticDue(time.Now().Add(time.Hour)); len(due) != 0 {
+		t.Errorf("connected static peer dialed: %v", due)
+	}
+
+	// 断开后在 backoff 之后重连
+	srv.removePeer(srv.Peers[id])
+	srv.staticPeerDropped(id)
+	if due := srv.staticDue(time.Now()); len(due) != 0 {
+		t.Errorf("static peer redialed without backoff")
+	}
+	if due := srv.staticDue(time.Now().Add(staticDialBackoff)); len(due) != 1 {
+		t.Errorf("static peer not redialed after disconnect")
+	}
+
+	srv.RemoveStaticPeer(id)
+	if peers := srv.StaticPeers(); len(peers) != 0 {
+		t.Errorf("static peer not removed: %v", peers)
+	}
+}
+
+func TestStaticPeerSlots(t *testing.T) {
+	srv := NewServer(&Config{MaxPeers: 3})
+	if err := srv.addPeer(&Peer{ID: testPeerID(0)}); err != nil {
+		t.Fatalf("dialed peer refused: %v", err)
+	}
+	// 主动连接的槽位已满, static 节点仍然可以连接
+	if err := srv.addPeer(&Peer{ID: testPeerID(1)}); err != DiscTooManyPeers {
+		t.Errorf("error mismatch: have %v, want %v", err, DiscTooManyPeers)
+	}
+	srv.AddStaticPeer(peer.AddrInfo{ID: testPeerID(1)})
+	if err := srv.addPeer(&Peer{ID: testPeerID(1)}); err != nil {
+		t.Errorf("static peer refused: %v", err)
+	}
+}
+
+func TestParsePeerAddrs(t *testing.T) {
+	addrs := parsePeerAddrs([]string{
+		"/ip4/127.0.0.1/tcp/10000/p2p/16Uiu2HAm3f3prVE7MkqeuzDBNC5GoNkoeR91NVz7MaL3HGSD9tzD",
+		"/ip4/127.0.0.1/tcp/10001",
+		"invalid",
+	})
+	if len(addrs) != 1 || addrs[0].ID.Pretty() != "16Uiu2HAm3f3prVE7MkqeuzDBNC5GoNkoeR91NVz7MaL3HGSD9tzD" {
+		t.Errorf("parsed addrs mismatch: %v", addrs)
+	}
+}
+
+// testRouter 对任何主题都返回固定的节点
+type testRouter struct {
+	peers []peer.AddrInfo
+}
+
+func (r *testRouter) Provide(context.Context, cid.Cid, bool) error { return nil }
+
+func (r *testRouter) FindProvidersAsync(ctx context.Context, _ cid.Cid, _ int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo, len(r.peers))
+	for _, p := range r.peers {
+		ch <- p
+	}
+	close(ch)
+	return ch
+}
+
+func TestStopEndsDialLoops(t *testing.T) {
+	host, err := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatalf("failed to create host: %v", err)
+	}
+	defer host.Close()
+
+	srv := NewServer(&Config{MaxPeers: 3})
+	srv.Host = host
+	srv.RoutingDiscovery = discovery.NewRoutingDiscovery(&testRouter{
+		peers: []peer.AddrInfo{{ID: testPeerID(1)}, {ID: testPeerID(2)}},
+	})
+
+	// 没有人读取 peerChan 时, findPeers 阻塞在发送上
+	findDone, startDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		srv.findPeers(context.Background(), TOPIC_PERCEPTION)
+		close(findDone)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	srv.Config.NoDiscovery = true
+	go func() {
+		srv.Start()
+		close(startDone)
+	}()
+
+	close(srv.quit)
+	for _, done := range []chan struct{}{findDone, startDone} {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("loop not stopped after quit")
+		}
+	}
+}
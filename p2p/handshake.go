@@ -3,8 +3,6 @@ package p2p
 import (
 	"fmt"
 	"log"
-
-	"github.com/czh0526/perception/rlp"
 )
 
 func perceptionHandshake(rw *ProtoRW, our *protoHandshake) (their *protoHandshake, err error) {
@@ -20,6 +18,8 @@ func perceptionHandshake(rw *ProtoRW, our *protoHandshake) (their *protoHandshak
 	if err := <-werr; err != nil {
 		return nil, fmt.Errorf("write error: %v", err)
 	}
+	// 双方都支持时, 之后的消息使用 snappy 压缩
+	rw.snappy = our.Version >= snappyProtocolVersion && their.Version >= snappyProtocolVersion
 	return their, nil
 }
 
@@ -32,9 +32,7 @@ func readHandshakeMsg(rw MsgReader) (*protoHandshake, error) {
 		return nil, fmt.Errorf("message to big")
 	}
 	if msg.Code == discMsg {
-		var reason [1]DiscReason
-		rlp.Decode(msg.Payload, &reason)
-		return nil, reason[0]
+		return nil, decodeDiscReason(msg.Payload)
 	}
 	if msg.Code != handshakeMsg {
 		return nil, fmt.Errorf("expected handshake, got %x", msg.Code)
@@ -0,0 +1,58 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	mdns "github.com/libp2p/go-libp2p/p2p/discovery"
+)
+
+const (
+	// 在局域网中公布的 mDNS 服务名, 对应 TOPIC_PERCEPTION. 服务名是 DNS 标签, 不能包含 '/'.
+	mdnsServiceTag = "_perception-discovery._udp"
+
+	// 查询局域网节点的周期
+	mdnsInterval = 10 * time.Second
+)
+
+// mdnsNotifee 将 mDNS 发现的节点交给 Server 拨号
+type mdnsNotifee struct {
+	srv *Server
+}
+
+func (n *mdnsNotifee) HandlePeerFound(addrInfo peer.AddrInfo) {
+	srv := n.srv
+	if addrInfo.ID == srv.Host.ID() {
+		return
+	}
+	// 拨号时从 peerstore 中查找地址
+	srv.Host.Peerstore().AddAddrs(addrInfo.ID, addrInfo.Addrs, peerstore.TempAddrTTL)
+	select {
+	case srv.peerChan <- addrInfo:
+	case <-srv.quit:
+	}
+}
+
+// 启动 mDNS 服务, 在局域网中公布自己并查找其他节点. 在 Host 创建之后调用.
+func (srv *Server) setupMDNS(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	service, err := mdns.NewMdnsService(ctx, srv.Host, mdnsInterval, mdnsServiceTag)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("new mDNS service error: %v", err)
+	}
+	service.RegisterNotifee(&mdnsNotifee{srv})
+	log.Printf("\t mDNS discovery ==> %v \n", mdnsServiceTag)
+
+	// Server 停止时结束查询
+	go func() {
+		<-srv.quit
+		cancel()
+		service.Close()
+	}()
+	return nil
+}
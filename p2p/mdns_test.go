@@ -0,0 +1,53 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestMDNSNotifee(t *testing.T) {
+	host, err := libp2p.New(context.Background(), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatalf("failed to create host: %v", err)
+	}
+	defer host.Close()
+	srv := NewServer(&Config{MaxPeers: 3})
+	srv.Host = host
+	notifee := &mdnsNotifee{srv}
+
+	// 自己的 mDNS 记录被忽略
+	notifee.HandlePeerFound(peer.AddrInfo{ID: host.ID()})
+
+	addr, _ := ma.NewMultiaddr("/ip4/192.168.1.2/tcp/10000")
+	found := peer.AddrInfo{ID: testPeerID(1), Addrs: []ma.Multiaddr{addr}}
+	go notifee.HandlePeerFound(found)
+	select {
+	case addrInfo := <-srv.peerChan:
+		if addrInfo.ID != found.ID {
+			t.Errorf("peer mismatch: have %v, want %v", addrInfo.ID, found.ID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("found peer not delivered")
+	}
+	if addrs := host.Peerstore().Addrs(found.ID); len(addrs) != 1 || !addrs[0].Equal(addr) {
+		t.Errorf("peerstore addresses mismatch: %v", addrs)
+	}
+
+	// Server 停止之后不再阻塞
+	close(srv.quit)
+	done := make(chan struct{})
+	go func() {
+		notifee.HandlePeerFound(found)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("notifee blocked after server stopped")
+	}
+}
@@ -10,9 +10,11 @@ import (
 
 type Msg struct {
 	Code       uint64
-	Size       uint32
+	Size       uint32 // 消息体解压之后的长度
 	Payload    io.Reader
 	ReceivedAt time.Time
+
+	wireSize uint32 // 消息体在连接上的长度, 压缩时小于 Size
 }
 
 func (msg Msg) String() string {
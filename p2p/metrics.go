@@ -0,0 +1,128 @@
+package p2p
+
+import (
+	"fmt"
+
+	flow "github.com/libp2p/go-flow-metrics"
+)
+
+// 全部节点的流量统计
+var totalTraffic = new(trafficMeter)
+
+// trafficMeter 统计一个连接或者全部连接的流量, 字节数包含帧头
+type trafficMeter struct {
+	ingress, egress         flow.Meter         // 字节数
+	ingressMsgs, egressMsgs flow.MeterRegistry // 按照消息类型统计的消息数
+	dropped                 flow.Meter         // 收到但是没有交给协议处理的消息数
+	errors                  flow.Meter         // 读写失败的次数
+}
+
+// 基础协议的消息名, 没有登记的消息码使用数值
+func baseMsgName(code uint64) string {
+	if code < baseProtocolLength {
+		if name := msgType(code); name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%02x", code)
+}
+
+func (m *trafficMeter) markIngress(name string, size uint32) {
+	m.ingress.Mark(uint64(frameHeaderSize + size))
+	m.ingressMsgs.Get(name).Mark(1)
+}
+
+func (m *trafficMeter) markEgress(name string, size uint32) {
+	m.egress.Mark(uint64(frameHeaderSize + size))
+	m.egressMsgs.Get(name).Mark(1)
+}
+
+// MeterInfo 是计量的快照, Rate 是最近的每秒速率
+type MeterInfo struct {
+	Total uint64  `json:"total"`
+	Rate  float64 `json:"rate"`
+}
+
+func meterInfo(m *flow.Meter) MeterInfo {
+	snapshot := m.Snapshot()
+	return MeterInfo{Total: snapshot.Total, Rate: snapshot.Rate}
+}
+
+func registryInfo(r *flow.MeterRegistry) map[string]MeterInfo {
+	infos := make(map[string]MeterInfo)
+	r.ForEach(func(name string, m *flow.Meter) {
+		infos[name] = meterInfo(m)
+	})
+	return infos
+}
+
+// TrafficInfo 是 admin_peers 和 admin_traffic 返回的流量统计
+type TrafficInfo struct {
+	Ingress     MeterInfo            `json:"ingress"`     // 收到的字节数
+	Egress      MeterInfo            `json:"egress"`      // 发送的字节数
+	IngressMsgs map[string]MeterInfo `json:"ingressMsgs"` // 按照消息类型统计的收到的消息数
+	EgressMsgs  map[string]MeterInfo `json:"egressMsgs"`  // 按照消息类型统计的发送的消息数
+	Dropped     MeterInfo            `json:"dropped"`
+	Errors      MeterInfo            `json:"errors"`
+}
+
+func (m *trafficMeter) info() *TrafficInfo {
+	return &TrafficInfo{
+		Ingress:     meterInfo(&m.ingress),
+		Egress:      meterInfo(&m.egress),
+		IngressMsgs: registryInfo(&m.ingressMsgs),
+		EgressMsgs:  registryInfo(&m.egressMsgs),
+		Dropped:     meterInfo(&m.dropped),
+		Errors:      meterInfo(&m.errors),
+	}
+}
+
+// meteredRW 在 ProtoRW 上统计一个连接的流量, 同时计入全部节点的统计
+type meteredRW struct {
+	*ProtoRW
+	traffic *trafficMeter
+	msgName func(code uint64) string // 消息在统计中的名字, 由 Peer 按照协商的协议设置
+}
+
+func newMeteredRW(rw *ProtoRW) *meteredRW {
+	return &meteredRW{ProtoRW: rw, traffic: new(trafficMeter), msgName: baseMsgName}
+}
+
+func (rw *meteredRW) ReadMsg() (Msg, error) {
+	msg, err := rw.ProtoRW.ReadMsg()
+	if err != nil {
+		rw.markError()
+		return msg, err
+	}
+	name := rw.msgName(msg.Code)
+	rw.traffic.markIngress(name, msg.wireSize)
+	totalTraffic.markIngress(name, msg.wireSize)
+	return msg, nil
+}
+
+func (rw *meteredRW) WriteMsg(msg Msg) error {
+	wireSize, err := rw.ProtoRW.writeMsg(msg)
+	if err != nil {
+		rw.markError()
+		return err
+	}
+	name := rw.msgName(msg.Code)
+	rw.traffic.markEgress(name, wireSize)
+	totalTraffic.markEgress(name, wireSize)
+	return nil
+}
+
+func (rw *meteredRW) markError() {
+	rw.traffic.errors.Mark(1)
+	totalTraffic.errors.Mark(1)
+}
+
+func (rw *meteredRW) markDropped() {
+	rw.traffic.dropped.Mark(1)
+	totalTraffic.dropped.Mark(1)
+}
+
+// Traffic 返回全部节点的流量统计
+func (srv *Server) Traffic() *TrafficInfo {
+	return totalTraffic.info()
+}
@@ -0,0 +1,102 @@
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// 等待 flow 的后台 goroutine 更新快照
+func waitTraffic(t *testing.T, traffic *trafficMeter, check func(*TrafficInfo) bool) *TrafficInfo {
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		info := traffic.info()
+		if check(info) {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for traffic: %+v", info)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestMeteredRW(t *testing.T) {
+	c1, c2 := net.Pipe()
+	w, r := newMeteredRW(NewProtoRW(&pipeStream{conn: c1})), newMeteredRW(NewProtoRW(&pipeStream{conn: c2}))
+	defer c1.Close()
+	defer c2.Close()
+
+	go func() {
+		SendItems(w, pingMsg)
+		SendItems(w, pingMsg)
+		SendItems(w, pongMsg)
+	}()
+	for i := 0; i < 3; i++ {
+		if _, err := r.ReadMsg(); err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+	}
+	// 空列表编码为 1 字节
+	const frameSize = frameHeaderSize + 1
+
+	info := waitTraffic(t, r.traffic, func(info *TrafficInfo) bool { return info.Ingress.Total == 3*frameSize })
+	if info.IngressMsgs["pingMsg"].Total != 2 || info.IngressMsgs["pongMsg"].Total != 1 {
+		t.Errorf("ingress message count mismatch: %+v", info.IngressMsgs)
+	}
+	info = waitTraffic(t, w.traffic, func(info *TrafficInfo) bool { return info.Egress.Total == 3*frameSize })
+	if info.EgressMsgs["pingMsg"].Total != 2 || info.Ingress.Total != 0 {
+		t.Errorf("egress mismatch: %+v", info)
+	}
+
+	// 写入失败计入 errors
+	if err := SendItems(w, baseProtocolLength, "data"); err != errMsgTooLarge {
+		t.Fatalf("error mismatch: have %v, want %v", err, errMsgTooLarge)
+	}
+	waitTraffic(t, w.traffic, func(info *TrafficInfo) bool { return info.Errors.Total == 1 })
+}
+
+func TestPeerTrafficDropped(t *testing.T) {
+	p1, p2 := newTestPeers(nil)
+	errc := make(chan error, 1)
+	go func() { errc <- p2.run() }()
+
+	// 没有分配的消息码被丢弃, 连接被断开
+	go SendItems(p1.protoRW.ProtoRW, handshakeMsg+5)
+	select {
+	case err := <-errc:
+		if err != errInvalidMsg {
+			t.Errorf("error mismatch: have %v, want %v", err, errInvalidMsg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for peer to stop")
+	}
+	waitTraffic(t, p2.protoRW.traffic, func(info *TrafficInfo) bool { return info.Dropped.Total == 1 })
+	if info := p2.Info(); info.Traffic == nil || info.Traffic.IngressMsgs["0x05"].Total != 1 {
+		t.Errorf("peer info traffic mismatch: %+v", info.Traffic)
+	}
+}
+
+func TestPeerMsgName(t *testing.T) {
+	protos := []Protocol{
+		{Name: "b", Version: 1, Length: 3},
+		{Name: "a", Version: 1, Length: 2},
+	}
+	p, _ := newTestPeers(protos)
+
+	// 子协议的消息按照协商得到的区间命名, 与其他协议无关
+	tests := map[uint64]string{
+		pingMsg:                 "pingMsg",
+		handshakeMsg + 5:        "0x05",
+		baseProtocolLength:      "a/0",
+		baseProtocolLength + 1:  "a/1",
+		baseProtocolLength + 2:  "b/0",
+		baseProtocolLength + 4:  "b/2",
+		baseProtocolLength + 10: "0x1a",
+	}
+	for code, want := range tests {
+		if name := p.protoRW.msgName(code); name != want {
+			t.Errorf("code %d: name mismatch: have %q, want %q", code, name, want)
+		}
+	}
+}
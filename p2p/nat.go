@@ -0,0 +1,88 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	autonat "github.com/libp2p/go-libp2p-autonat"
+	circuit "github.com/libp2p/go-libp2p-circuit"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// circuit relay 的模式
+const (
+	RelayOff    = "off"    // 不使用中继
+	RelayClient = "client" // 可以通过中继节点拨号, 也可以接受经过中继的连接
+	RelayHop    = "hop"    // 同时为其他节点中继流量
+)
+
+// 根据 NAT 和中继的配置生成 libp2p 的选项
+func natOptions(config *Config) ([]libp2p.Option, error) {
+	var opts []libp2p.Option
+
+	if config.NAT {
+		opts = append(opts, libp2p.NATPortMap())
+	}
+
+	if len(config.ExternalAddrs) > 0 {
+		var external []ma.Multiaddr
+		for _, addr := range config.ExternalAddrs {
+			maddr, err := ma.NewMultiaddr(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid external address %q: %v", addr, err)
+			}
+			external = append(external, maddr)
+		}
+		// 在本地地址之外公布外部地址, 局域网中的节点仍然可以使用本地地址
+		opts = append(opts, libp2p.AddrsFactory(func(addrs []ma.Multiaddr) []ma.Multiaddr {
+			return append(append([]ma.Multiaddr{}, external...), addrs...)
+		}))
+	}
+
+	switch config.Relay {
+	case "", RelayClient:
+		opts = append(opts, libp2p.EnableRelay())
+	case RelayHop:
+		opts = append(opts, libp2p.EnableRelay(circuit.OptHop))
+	case RelayOff:
+		if config.AutoRelay {
+			return nil, fmt.Errorf("autorelay requires circuit relay")
+		}
+		opts = append(opts, libp2p.DisableRelay())
+	default:
+		return nil, fmt.Errorf("unknown relay mode %q", config.Relay)
+	}
+	if config.AutoRelay {
+		opts = append(opts, libp2p.EnableAutoRelay())
+	}
+	return opts, nil
+}
+
+// 启动 AutoNAT, 通过已连接的节点检测本节点是否可以被公网访问. 在 Host 创建之后调用.
+func (srv *Server) setupAutoNAT(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	srv.autoNAT = autonat.NewAutoNAT(ctx, srv.Host, nil)
+	log.Println("\t AutoNAT reachability detection enabled")
+
+	// Server 停止时结束检测
+	go func() {
+		<-srv.quit
+		cancel()
+	}()
+}
+
+// 返回 AutoNAT 检测到的可达性: public, private 或者 unknown. 没有启用 AutoNAT 时为 unknown.
+func (srv *Server) Reachability() string {
+	if srv.autoNAT == nil {
+		return "unknown"
+	}
+	switch srv.autoNAT.Status() {
+	case autonat.NATStatusPublic:
+		return "public"
+	case autonat.NATStatusPrivate:
+		return "private"
+	}
+	return "unknown"
+}
@@ -0,0 +1,52 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+
+	libp2p "github.com/libp2p/go-libp2p"
+)
+
+func TestNATOptions(t *testing.T) {
+	tests := []struct {
+		config Config
+		ok     bool
+	}{
+		{Config{}, true},
+		{Config{NAT: true, AutoRelay: true}, true},
+		{Config{Relay: RelayHop, AutoRelay: true}, true},
+		{Config{Relay: RelayOff}, true},
+		{Config{Relay: RelayOff, AutoRelay: true}, false},
+		{Config{Relay: "always"}, false},
+		{Config{ExternalAddrs: []string{"1.2.3.4:10000"}}, false},
+	}
+	for i, test := range tests {
+		if _, err := natOptions(&test.config); (err == nil) != test.ok {
+			t.Errorf("test %d: error mismatch: %v", i, err)
+		}
+	}
+}
+
+func TestExternalAddrs(t *testing.T) {
+	opts, err := natOptions(&Config{ExternalAddrs: []string{"/ip4/1.2.3.4/tcp/10000"}})
+	if err != nil {
+		t.Fatalf("failed to make options: %v", err)
+	}
+	opts = append(opts, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	host, err := libp2p.New(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("failed to create host: %v", err)
+	}
+	defer host.Close()
+
+	// 外部地址和本地地址都被公布
+	addrs := host.Addrs()
+	if len(addrs) < 2 || addrs[0].String() != "/ip4/1.2.3.4/tcp/10000" {
+		t.Errorf("announced addresses mismatch: %v", addrs)
+	}
+
+	srv := NewServer(&Config{})
+	if reachability := srv.Reachability(); reachability != "unknown" {
+		t.Errorf("reachability mismatch: have %s, want unknown", reachability)
+	}
+}
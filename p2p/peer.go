@@ -3,6 +3,7 @@ package p2p
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"sort"
 	"sync"
@@ -13,6 +14,9 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 )
 
+// 对端发送了无法处理的消息
+var errInvalidMsg = errors.New("invalid message")
+
 const (
 	handshakeMsg = 0x00
 	discMsg      = 0x01
@@ -35,7 +39,7 @@ const (
 	DiscUnexpectedIdentity
 	DiscSelf
 	DiscReadTimeout
-	DiscSubprotocolError = 0x10
+	DiscSubprotocolError DiscReason = 0x10
 )
 
 var discReasonToString = [...]string{
@@ -55,21 +59,37 @@ var discReasonToString = [...]string{
 }
 
 func (d DiscReason) String() string {
-	if len(discReasonToString) < int(d) {
+	if !d.valid() {
 		return fmt.Sprintf("unknown disconnect reason %d", d)
 	}
 	return discReasonToString[d]
 }
 
+func (d DiscReason) valid() bool {
+	return int(d) < len(discReasonToString) && discReasonToString[d] != ""
+}
+
+// 解码对端在 discMsg 中发送的原因, 无法解码或者未定义的原因视为无效消息
+func decodeDiscReason(r io.Reader) error {
+	var reason [1]DiscReason
+	if err := rlp.Decode(r, &reason); err != nil || !reason[0].valid() {
+		return errInvalidMsg
+	}
+	return reason[0]
+}
+
 func (d DiscReason) Error() string {
 	return d.String()
 }
 
 const (
-	baseProtocolVersion    = 1
+	baseProtocolVersion    = 2
 	baseProtocolLength     = uint64(16)
 	baseProtocolMaxMsgSize = 2 * 1024
 
+	// 从该版本开始支持 snappy 压缩消息体
+	snappyProtocolVersion = 2
+
 	pingInterval = 10 * time.Second
 )
 
@@ -83,8 +103,11 @@ type protoHandshake struct {
 type Peer struct {
 	ID         peer.ID
 	RemoteAddr []ma.Multiaddr
-	protoRW    *ProtoRW
-	running    map[string]Protocol
+	name       string
+	caps       []Cap
+	inbound    bool
+	protoRW    *meteredRW
+	running    map[string]*protoRW // 协商成功的协议, 共享同一个 stream
 
 	protoErr chan error
 	disc     chan error    // 控制开关
@@ -92,43 +115,111 @@ type Peer struct {
 	wg       sync.WaitGroup
 }
 
-func matchProtocols(remoteId peer.ID, protocols []Protocol, caps []Cap) map[string]Protocol {
-	sort.Sort(capsByNameAndVersion(caps))
-	result := make(map[string]Protocol)
-
-outer:
+// 对每个协议名, 选择本地和对端都支持的最高版本
+func matchProtocols(protocols []Protocol, caps []Cap) map[string]Protocol {
+	remote := make(map[Cap]bool, len(caps))
 	for _, cap := range caps {
-		for _, proto := range protocols {
-			if cap.Name == proto.Name && cap.Version == proto.Version {
-				result[cap.Name] = proto
-			}
-
-			continue outer
+		remote[cap] = true
+	}
+	result := make(map[string]Protocol)
+	for _, proto := range protocols {
+		if !remote[proto.Cap()] {
+			continue
+		}
+		if matched, exists := result[proto.Name]; !exists || proto.Version > matched.Version {
+			result[proto.Name] = proto
 		}
 	}
 	return result
 }
 
-func newPeer(remoteAddr peer.AddrInfo, protoRW *ProtoRW, caps []Cap, protocols []Protocol) *Peer {
+func newPeer(remoteAddr peer.AddrInfo, name string, protoRW *ProtoRW, caps []Cap, protocols []Protocol) *Peer {
 	log.Printf("2). match protocol\n")
-	matches := matchProtocols(remoteAddr.ID, protocols, caps)
+	sort.Sort(capsByNameAndVersion(caps))
+	matches := matchProtocols(protocols, caps)
 	for _, proto := range matches {
 		log.Printf("\t\t protocol match ==> '/%s/%d' \n", proto.Name, proto.Version)
 	}
 	p := &Peer{
 		ID:         remoteAddr.ID,
 		RemoteAddr: remoteAddr.Addrs,
-		protoRW:    protoRW,
-		running:    matches,
-		protoErr:   make(chan error, len(matches)+1), // protocols + pingLoop
+		name:       name,
+		caps:       caps,
+		protoRW:    newMeteredRW(protoRW),
+		protoErr:   make(chan error, len(matches)+2), // protocols + pingLoop + readLoop
 		disc:       make(chan error),
 		closed:     make(chan struct{}),
 	}
+	p.running = assignOffsets(matches, p.closed, p.protoRW)
+	protoRW.limit = p.msgLimit
+	p.protoRW.msgName = p.msgName
 
 	return p
 }
 
-func (p *Peer) run(initial bool) error {
+// 对端在握手时声明的名字
+func (p *Peer) Name() string {
+	return p.name
+}
+
+// 对端在握手时声明的协议列表
+func (p *Peer) Caps() []Cap {
+	return p.caps
+}
+
+// 连接是否由对端发起
+func (p *Peer) Inbound() bool {
+	return p.inbound
+}
+
+// PeerInfo 是 admin_peers 返回的节点信息
+type PeerInfo struct {
+	ID      string   `json:"id"`   // libp2p peer id
+	Name    string   `json:"name"` // 对端在握手时声明的名字
+	Caps    []string `json:"caps"` // 对端声明的协议列表
+	Network struct {
+		RemoteAddresses []string `json:"remoteAddresses"`
+		Inbound         bool     `json:"inbound"`
+		Trusted         bool     `json:"trusted"`
+		Latency         string   `json:"latency"`
+	} `json:"network"`
+	Protocols map[string]interface{} `json:"protocols"` // 协商成功的协议以及协议相关的信息
+	Traffic   *TrafficInfo           `json:"traffic"`   // 与该节点之间的流量
+}
+
+// 收集节点的基本信息, 以及协商成功的协议提供的信息
+func (p *Peer) Info() *PeerInfo {
+	var caps []string
+	for _, cap := range p.Caps() {
+		caps = append(caps, cap.String())
+	}
+	info := &PeerInfo{
+		ID:        p.ID.Pretty(),
+		Name:      p.Name(),
+		Caps:      caps,
+		Protocols: make(map[string]interface{}),
+		Traffic:   p.protoRW.traffic.info(),
+	}
+	for _, addr := range p.RemoteAddr {
+		info.Network.RemoteAddresses = append(info.Network.RemoteAddresses, addr.String())
+	}
+	info.Network.Inbound = p.inbound
+
+	for _, proto := range p.running {
+		protoInfo := interface{}("unknown")
+		if query := proto.PeerInfo; query != nil {
+			if metadata := query(p.ID); metadata != nil {
+				protoInfo = metadata
+			} else {
+				protoInfo = "handshake"
+			}
+		}
+		info.Protocols[proto.Name] = protoInfo
+	}
+	return info
+}
+
+func (p *Peer) run() error {
 	var (
 		err    error
 		reason error
@@ -138,7 +229,7 @@ func (p *Peer) run(initial bool) error {
 	go p.pingLoop()
 	go p.readLoop()
 
-	startProtocols(p.ID, p.running, initial)
+	p.startProtocols()
 
 loop:
 	for {
@@ -149,7 +240,8 @@ loop:
 				break loop
 			}
 		case err = <-p.disc:
-			reason = fmt.Errorf("Disconnect conn, reason = %v.", err)
+			log.Printf("Disconnect conn, reason = %v.", err)
+			reason = err
 			break loop
 		}
 	}
@@ -213,12 +305,61 @@ func (p *Peer) handle(msg Msg) error {
 		return nil
 
 	case msg.Code == discMsg:
-		var reason [1]DiscReason
-		rlp.Decode(msg.Payload, &reason)
-		return reason[0]
+		return decodeDiscReason(msg.Payload)
+
+	case msg.Code < baseProtocolLength:
+		log.Printf("unknown msg: %v", msg)
+		p.protoRW.markDropped()
+		return errInvalidMsg
 
 	default:
-		return errors.New(fmt.Sprintf("unknown msg: %v \n", msg))
+		// 按照消息码的区间分发给对应的协议
+		rw, err := p.getProto(msg.Code)
+		if err != nil {
+			log.Printf("unknown msg: %v", msg)
+			p.protoRW.markDropped()
+			return errInvalidMsg
+		}
+		select {
+		case rw.in <- msg:
+		case <-p.closed:
+			p.protoRW.markDropped()
+			return io.EOF
+		}
 	}
 	return nil
 }
+
+// 返回消息码允许的最大长度, 未分配的消息码不允许携带数据
+func (p *Peer) msgLimit(code uint64) uint32 {
+	if code < baseProtocolLength {
+		return baseProtocolMaxMsgSize
+	}
+	rw, err := p.getProto(code)
+	if err != nil {
+		return 0
+	}
+	return rw.sizeLimit()
+}
+
+// 消息在流量统计中的名字, 子协议的消息记为 <协议名>/<协议内的消息码>
+func (p *Peer) msgName(code uint64) string {
+	if code < baseProtocolLength {
+		return baseMsgName(code)
+	}
+	rw, err := p.getProto(code)
+	if err != nil {
+		return baseMsgName(code)
+	}
+	return fmt.Sprintf("%s/%d", rw.Name, code-rw.offset)
+}
+
+// 查找消息码所属的协议
+func (p *Peer) getProto(code uint64) (*protoRW, error) {
+	for _, rw := range p.running {
+		if code >= rw.offset && code < rw.offset+rw.Length {
+			return rw, nil
+		}
+	}
+	return nil, errInvalidMsgCode
+}
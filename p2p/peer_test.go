@@ -0,0 +1,66 @@
+package p2p
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/czh0526/perception/rlp"
+)
+
+func TestMatchProtocols(t *testing.T) {
+	local := []Protocol{
+		{Name: "proton", Version: 1},
+		{Name: "proton", Version: 2},
+		{Name: "proton", Version: 3},
+		{Name: "les", Version: 1},
+		{Name: "shh", Version: 1},
+	}
+	tests := []struct {
+		caps []Cap
+		want map[string]uint
+	}{
+		// 选择双方都支持的最高版本
+		{[]Cap{{"proton", 1}, {"proton", 2}}, map[string]uint{"proton": 2}},
+		{[]Cap{{"proton", 2}, {"proton", 4}, {"les", 1}}, map[string]uint{"proton": 2, "les": 1}},
+		// 只匹配第一个本地协议的旧实现会漏掉后面的协议
+		{[]Cap{{"shh", 1}}, map[string]uint{"shh": 1}},
+		{[]Cap{{"proton", 4}, {"eth", 63}}, map[string]uint{}},
+		{nil, map[string]uint{}},
+	}
+	for i, tt := range tests {
+		matches := matchProtocols(local, tt.caps)
+		if len(matches) != len(tt.want) {
+			t.Errorf("test %d: matches mismatch: have %v, want %v", i, matches, tt.want)
+			continue
+		}
+		for name, version := range tt.want {
+			if proto, ok := matches[name]; !ok || proto.Version != version {
+				t.Errorf("test %d: %s mismatch: have %v, want version %d", i, name, proto.Cap(), version)
+			}
+		}
+	}
+}
+
+func TestDecodeDiscReason(t *testing.T) {
+	tests := []struct {
+		reason DiscReason
+		want   error
+	}{
+		{DiscTooManyPeers, DiscTooManyPeers},
+		{DiscSubprotocolError, DiscSubprotocolError},
+		{DiscReadTimeout + 1, errInvalidMsg},
+		{DiscSubprotocolError + 1, errInvalidMsg},
+		{1000, errInvalidMsg},
+	}
+	for _, test := range tests {
+		payload, _ := rlp.EncodeToBytes([]DiscReason{test.reason})
+		if err := decodeDiscReason(bytes.NewReader(payload)); err != test.want {
+			t.Errorf("reason %d: error mismatch: have %v, want %v", test.reason, err, test.want)
+		}
+		// 未定义的原因也可以安全地转换为字符串
+		_ = test.reason.String()
+	}
+	if err := decodeDiscReason(bytes.NewReader([]byte{0xff})); err != errInvalidMsg {
+		t.Errorf("error mismatch: have %v, want %v", err, errInvalidMsg)
+	}
+}
@@ -1,16 +1,41 @@
 package p2p
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sort"
 
 	"github.com/libp2p/go-libp2p-core/peer"
 )
 
+var (
+	errProtocolReturned = errors.New("protocol returned")
+	errInvalidMsgCode   = errors.New("invalid message code")
+)
+
 type Protocol struct {
 	Name    string
 	Version uint
-	Run     func(remoteID peer.ID, initial bool) error
+
+	// 协议使用的消息码数量, 消息码的范围是 [0, Length)
+	Length uint64
+
+	// 本协议单个消息的最大长度, 为 0 时使用 defaultMaxMsgSize, 不能超过 maxMsgSize.
+	// 超过长度的消息在分配内存之前被拒绝, 连接被断开.
+	MaxMsgSize uint32
+
+	// 与对端协商成功后在新的 goroutine 中调用, 通过 rw 收发本协议的消息.
+	// 返回时与对端的连接被断开.
+	Run func(p *Peer, rw MsgReadWriter) error
+
+	// 可选, 返回协议相关的本地节点信息, 用于 admin_nodeInfo
+	NodeInfo func() interface{}
+
+	// 可选, 返回协议相关的远端节点信息, 用于 admin_peers.
+	// 节点尚未完成协议握手时返回 nil.
+	PeerInfo func(id peer.ID) interface{}
 }
 
 func (p Protocol) Cap() Cap {
@@ -34,13 +59,81 @@ func (cs capsByNameAndVersion) Less(i, j int) bool {
 	return cs[i].Name < cs[j].Name || (cs[i].Name == cs[j].Name && cs[i].Version < cs[j].Version)
 }
 
-func startProtocols(peerId peer.ID, protos map[string]Protocol, initial bool) {
-	// 启动全部的协议模块
-	for _, proto := range protos {
-		proto := proto
+// protoRW 是协议在共享连接上的读写端, 消息码加上 offset 之后在连接上传输
+type protoRW struct {
+	Protocol
+	in     chan Msg        // readLoop 分发给本协议的消息
+	closed <-chan struct{} // 连接关闭时被关闭
+	offset uint64
+	w      MsgWriter
+}
+
+// 按照协议名的顺序为协商成功的协议分配消息码的区间, 基础协议占用 [0, baseProtocolLength)
+func assignOffsets(matches map[string]Protocol, closed <-chan struct{}, w MsgWriter) map[string]*protoRW {
+	names := make([]string, 0, len(matches))
+	for name := range matches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make(map[string]*protoRW, len(matches))
+	offset := baseProtocolLength
+	for _, name := range names {
+		proto := matches[name]
+		result[name] = &protoRW{
+			Protocol: proto,
+			in:       make(chan Msg),
+			closed:   closed,
+			offset:   offset,
+			w:        w,
+		}
+		offset += proto.Length
+	}
+	return result
+}
+
+// 本协议允许的最大消息长度
+func (rw *protoRW) sizeLimit() uint32 {
+	switch {
+	case rw.MaxMsgSize == 0:
+		return defaultMaxMsgSize
+	case rw.MaxMsgSize > maxMsgSize:
+		return maxMsgSize
+	}
+	return rw.MaxMsgSize
+}
+
+func (rw *protoRW) WriteMsg(msg Msg) error {
+	if msg.Code >= rw.Length {
+		return errInvalidMsgCode
+	}
+	msg.Code += rw.offset
+	return rw.w.WriteMsg(msg)
+}
+
+func (rw *protoRW) ReadMsg() (Msg, error) {
+	select {
+	case msg := <-rw.in:
+		msg.Code -= rw.offset
+		return msg, nil
+	case <-rw.closed:
+		return Msg{}, io.EOF
+	}
+}
+
+// 启动全部的协议模块, 协议返回的错误会使连接断开
+func (p *Peer) startProtocols() {
+	p.wg.Add(len(p.running))
+	for _, rw := range p.running {
+		rw := rw
 		go func() {
-			err := proto.Run(peerId, initial)
-			log.Printf("Protocol %s/%d exit with error: %v", proto.Name, proto.Version, err)
+			defer p.wg.Done()
+			err := rw.Run(p, rw)
+			if err == nil {
+				err = errProtocolReturned
+			}
+			log.Printf("Protocol %s/%d exit with error: %v", rw.Name, rw.Version, err)
+			p.protoErr <- err
 		}()
 	}
 }
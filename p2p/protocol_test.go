@@ -0,0 +1,136 @@
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// pipeStream 用 net.Pipe 模拟 libp2p stream, 只实现 ProtoRW 用到的方法
+type pipeStream struct {
+	network.Stream
+	conn net.Conn
+}
+
+func (s *pipeStream) Read(b []byte) (int, error)  { return s.conn.Read(b) }
+func (s *pipeStream) Write(b []byte) (int, error) { return s.conn.Write(b) }
+func (s *pipeStream) Close() error                { return s.conn.Close() }
+func (s *pipeStream) Protocol() protocol.ID       { return PROTO_PERCEPTION }
+
+func (s *pipeStream) SetReadDeadline(t time.Time) error  { return s.conn.SetReadDeadline(t) }
+func (s *pipeStream) SetWriteDeadline(t time.Time) error { return s.conn.SetWriteDeadline(t) }
+
+// 建立一对相互连接的 Peer, 双方都运行 protos
+func newTestPeers(protos []Protocol) (*Peer, *Peer) {
+	c1, c2 := net.Pipe()
+	var caps []Cap
+	for _, proto := range protos {
+		caps = append(caps, proto.Cap())
+	}
+	p1 := newPeer(peer.AddrInfo{ID: testPeerID(1)}, "p1", NewProtoRW(&pipeStream{conn: c1}), caps, protos)
+	p2 := newPeer(peer.AddrInfo{ID: testPeerID(2)}, "p2", NewProtoRW(&pipeStream{conn: c2}), caps, protos)
+	return p1, p2
+}
+
+func TestProtocolMultiplexing(t *testing.T) {
+	type received struct {
+		proto string
+		code  uint64
+		data  string
+	}
+	recv := make(chan received, 10)
+	runProto := func(name string) func(p *Peer, rw MsgReadWriter) error {
+		return func(p *Peer, rw MsgReadWriter) error {
+			if !p.Inbound() {
+				if err := Send(rw, 1, name); err != nil {
+					return err
+				}
+				if err := Send(rw, 100, name); err != errInvalidMsgCode {
+					t.Errorf("%s: error mismatch: have %v, want %v", name, err, errInvalidMsgCode)
+				}
+			}
+			for {
+				msg, err := rw.ReadMsg()
+				if err != nil {
+					return err
+				}
+				var data string
+				msg.Decode(&data)
+				recv <- received{name, msg.Code, data}
+			}
+		}
+	}
+	protos := []Protocol{
+		{Name: "b", Version: 1, Length: 3, Run: runProto("b")},
+		{Name: "a", Version: 1, Length: 2, Run: runProto("a")},
+	}
+	p1, p2 := newTestPeers(protos)
+	p2.inbound = true
+
+	// 按照协议名分配消息码区间
+	if p1.running["a"].offset != baseProtocolLength || p1.running["b"].offset != baseProtocolLength+2 {
+		t.Fatalf("offset mismatch: a %d, b %d", p1.running["a"].offset, p1.running["b"].offset)
+	}
+
+	errc := make(chan error, 2)
+	go func() { errc <- p1.run() }()
+	go func() { errc <- p2.run() }()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-recv:
+			if r.code != 1 || r.proto != r.data {
+				t.Errorf("message mismatch: %+v", r)
+			}
+			seen[r.proto] = true
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for protocol messages")
+		}
+	}
+	if !seen["a"] || !seen["b"] {
+		t.Errorf("messages not routed to both protocols: %v", seen)
+	}
+
+	// 断开一端, 两端的协议都结束
+	p1.Disconnect(DiscRequested)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-errc:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for peers to stop")
+		}
+	}
+}
+
+func TestProtocolReturnEndsPeer(t *testing.T) {
+	protos := []Protocol{
+		{Name: "a", Version: 1, Length: 1, Run: func(p *Peer, rw MsgReadWriter) error {
+			if p.Inbound() {
+				return DiscUselessPeer
+			}
+			_, err := rw.ReadMsg()
+			return err
+		}},
+	}
+	p1, p2 := newTestPeers(protos)
+	p2.inbound = true
+
+	errc := make(chan error, 2)
+	go func() { errc <- p1.run() }()
+	go func() { errc <- p2.run() }()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != DiscUselessPeer {
+				t.Errorf("error mismatch: have %v, want %v", err, DiscUselessPeer)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for peers to stop")
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package p2p
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/czh0526/perception/common/mclock"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// PeerEvent 是影响节点分数的行为
+type PeerEvent int
+
+const (
+	EventProtocolError  PeerEvent = iota // 违反协议, 例如无法解码的消息
+	EventInvalidBlock                    // 提供了无效的区块
+	EventTimeout                         // 请求超时
+	EventUsefulDelivery                  // 提供了有用的数据
+)
+
+var peerEventNames = [...]string{
+	EventProtocolError:  "protocol error",
+	EventInvalidBlock:   "invalid block",
+	EventTimeout:        "timeout",
+	EventUsefulDelivery: "useful delivery",
+}
+
+func (ev PeerEvent) String() string {
+	if int(ev) >= len(peerEventNames) {
+		return "unknown event"
+	}
+	return peerEventNames[ev]
+}
+
+// 每种行为对分数的影响, 分数低于阈值时断开连接使用的原因, 以及是否不论分数直接禁止连接
+var peerEventEffects = [...]struct {
+	score  float64
+	reason DiscReason
+	ban    bool
+}{
+	EventProtocolError:  {-25, DiscProtocolError, false},
+	EventInvalidBlock:   {-100, DiscUselessPeer, true},
+	EventTimeout:        {-10, DiscReadTimeout, false},
+	EventUsefulDelivery: {1, DiscUselessPeer, false},
+}
+
+const (
+	// 分数每经过一个半衰期衰减一半, 节点过去的行为逐渐被遗忘
+	scoreHalfLife = 10 * time.Minute
+
+	// 分数的上限, 避免节点积累过多的信用
+	maxPeerScore = 50
+
+	// 分数低于阈值的节点被断开并禁止连接
+	peerBanThreshold = -100
+
+	// 分数低于阈值后被禁止连接的时长
+	peerBanTime = 30 * time.Minute
+
+	// 绝对值低于该值的分数视为已经衰减到 0, 记录可以删除
+	minPeerScore = 0.5
+)
+
+type peerScore struct {
+	value   float64
+	updated mclock.AbsTime
+}
+
+// Scorer 记录节点的行为分数, 分数随时间向 0 衰减
+type Scorer struct {
+	clock  mclock.Clock
+	scores map[peer.ID]*peerScore
+	lock   sync.Mutex
+}
+
+func NewScorer(clock mclock.Clock) *Scorer {
+	return &Scorer{
+		clock:  clock,
+		scores: make(map[peer.ID]*peerScore),
+	}
+}
+
+// 将分数衰减到当前时间, 调用者需要持有 s.lock
+func (s *Scorer) decay(ps *peerScore, now mclock.AbsTime) {
+	elapsed := time.Duration(now - ps.updated)
+	ps.value *= math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife))
+	ps.updated = now
+}
+
+// 返回节点当前的分数, 没有记录的节点分数为 0
+func (s *Scorer) Score(id peer.ID) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ps := s.scores[id]
+	if ps == nil {
+		return 0
+	}
+	s.decay(ps, s.clock.Now())
+	return ps.value
+}
+
+// 记录节点的一次行为, 返回更新后的分数以及是否需要禁止连接.
+// 提供无效区块的节点不论之前积累了多少分数都被禁止连接.
+func (s *Scorer) Report(id peer.ID, ev PeerEvent) (float64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.clock.Now()
+	ps := s.scores[id]
+	if ps == nil {
+		ps = &peerScore{updated: now}
+		s.scores[id] = ps
+	}
+	s.decay(ps, now)
+	ps.value = math.Min(ps.value+peerEventEffects[ev].score, maxPeerScore)
+	return ps.value, peerEventEffects[ev].ban || ps.value <= peerBanThreshold
+}
+
+// 删除节点的分数记录
+func (s *Scorer) Forget(id peer.ID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.scores, id)
+}
+
+// 删除已经衰减到接近 0 的分数记录, 避免断开的节点一直占用内存
+func (s *Scorer) Prune() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.clock.Now()
+	for id, ps := range s.scores {
+		s.decay(ps, now)
+		if math.Abs(ps.value) < minPeerScore {
+			delete(s.scores, id)
+		}
+	}
+}
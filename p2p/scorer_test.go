@@ -0,0 +1,115 @@
+package p2p
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/czh0526/perception/common/mclock"
+	"github.com/czh0526/perception/db/memorydb"
+)
+
+func TestScorerDecay(t *testing.T) {
+	clock := new(mclock.Simulated)
+	scorer := NewScorer(clock)
+	id := testPeerID(0)
+
+	if score, ban := scorer.Report(id, EventProtocolError); score != -25 || ban {
+		t.Fatalf("score mismatch: have (%v, %v)", score, ban)
+	}
+	clock.Run(scoreHalfLife)
+	if score := scorer.Score(id); math.Abs(score+12.5) > 1e-9 {
+		t.Errorf("score not decayed: have %v, want -12.5", score)
+	}
+
+	// 分数有上限
+	for i := 0; i < 100; i++ {
+		scorer.Report(id, EventUsefulDelivery)
+	}
+	if score := scorer.Score(id); score != maxPeerScore {
+		t.Errorf("score mismatch: have %v, want %v", score, maxPeerScore)
+	}
+
+	// 从上限开始, 连续的超时最终使分数低于阈值
+	var banned bool
+	for i := 0; i < 15 && !banned; i++ {
+		_, banned = scorer.Report(id, EventTimeout)
+	}
+	if !banned {
+		t.Errorf("peer not below threshold after repeated timeouts, score %v", scorer.Score(id))
+	}
+
+	scorer.Forget(id)
+	if score := scorer.Score(id); score != 0 {
+		t.Errorf("score not forgotten: %v", score)
+	}
+}
+
+func TestScorerPrune(t *testing.T) {
+	clock := new(mclock.Simulated)
+	scorer := NewScorer(clock)
+
+	scorer.Report(testPeerID(0), EventTimeout)
+	scorer.Report(testPeerID(1), EventInvalidBlock)
+	scorer.Prune()
+	if len(scorer.scores) != 2 {
+		t.Fatalf("recent scores pruned: %v", scorer.scores)
+	}
+
+	// -10 经过 5 个半衰期衰减到 0.5 以下, -100 还没有
+	clock.Run(5 * scoreHalfLife)
+	scorer.Prune()
+	if _, ok := scorer.scores[testPeerID(0)]; ok || len(scorer.scores) != 1 {
+		t.Errorf("decayed score not pruned: %v", scorer.scores)
+	}
+}
+
+func TestReportPeerBan(t *testing.T) {
+	srv := NewServer(&Config{MaxPeers: 10})
+	srv.nodedb = memorydb.New()
+
+	bad, trusted := testPeerID(0), testPeerID(1)
+	srv.trusted[trusted] = true
+	srv.ReportPeer(bad, EventProtocolError)
+	if srv.IsBanned(bad) {
+		t.Fatal("peer banned after a single protocol error")
+	}
+	srv.ReportPeer(bad, EventInvalidBlock)
+	srv.ReportPeer(trusted, EventInvalidBlock)
+	if !srv.IsBanned(bad) {
+		t.Error("peer not banned after invalid block")
+	}
+	if srv.IsBanned(trusted) {
+		t.Error("trusted peer banned")
+	}
+	if score := srv.PeerScore(bad); score != 0 {
+		t.Errorf("score not reset after ban: %v", score)
+	}
+
+	// 积累了最高分数的节点提供无效区块, 同样被禁止连接
+	good := testPeerID(2)
+	for i := 0; i < 2*maxPeerScore; i++ {
+		srv.ReportPeer(good, EventUsefulDelivery)
+	}
+	if score := srv.PeerScore(good); score < maxPeerScore-1 {
+		t.Fatalf("score mismatch: have %v, want %v", score, maxPeerScore)
+	}
+	srv.ReportPeer(good, EventInvalidBlock)
+	if !srv.IsBanned(good) {
+		t.Error("peer with high score not banned after invalid block")
+	}
+	delete(srv.banned, good)
+	deleteBan(srv.nodedb, good)
+
+	// 禁止连接的记录保存在节点数据库中
+	bans := loadBans(srv.nodedb, time.Now())
+	if _, ok := bans[bad]; !ok || len(bans) != 1 {
+		t.Errorf("ban not persisted: %v", bans)
+	}
+	if bans := loadBans(srv.nodedb, time.Now().Add(peerBanTime+time.Minute)); len(bans) != 0 {
+		t.Errorf("expired ban loaded: %v", bans)
+	}
+	if bans := loadBans(srv.nodedb, time.Now()); len(bans) != 0 {
+		t.Errorf("expired ban not deleted: %v", bans)
+	}
+}
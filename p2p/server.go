@@ -9,10 +9,15 @@ import (
 	"sync"
 	"time"
 
+	"github.com/czh0526/perception/common/mclock"
+	"github.com/czh0526/perception/proton/chaindb"
 	libp2p "github.com/libp2p/go-libp2p"
+	autonat "github.com/libp2p/go-libp2p-autonat"
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
 	"github.com/libp2p/go-libp2p-core/protocol"
 	rt "github.com/libp2p/go-libp2p-core/routing"
 	discovery "github.com/libp2p/go-libp2p-discovery"
@@ -35,9 +40,17 @@ type Server struct {
 	ourHandshake *protoHandshake
 	Peers        map[peer.ID]*Peer
 	peerChan     chan peer.AddrInfo
+	banned       map[peer.ID]time.Time   // peer id ==> 解禁时间
+	trusted      map[peer.ID]bool        // 受信任的节点, 不会被禁止连接, 也不占用连接槽位
+	static       map[peer.ID]*staticPeer // 需要保持连接的节点
+	connMgr      *connmgr.BasicConnMgr   // 裁剪多余的 libp2p 连接
+	scorer       *Scorer                 // 节点的行为分数
+	nodedb       chaindb.KeyValueStore   // 保存禁止连接的记录
+	autoNAT      autonat.AutoNAT         // 检测本节点的可达性, 没有启用时为 nil
 
 	lock   sync.Mutex
 	Inited chan struct{}
+	quit   chan struct{}
 }
 
 func NewServer(config *Config) *Server {
@@ -45,7 +58,12 @@ func NewServer(config *Config) *Server {
 		Config:   config,
 		Peers:    make(map[peer.ID]*Peer),
 		peerChan: make(chan peer.AddrInfo),
+		banned:   make(map[peer.ID]time.Time),
+		trusted:  make(map[peer.ID]bool),
+		static:   make(map[peer.ID]*staticPeer),
+		scorer:   NewScorer(mclock.System{}),
 		Inited:   make(chan struct{}),
+		quit:     make(chan struct{}),
 	}
 }
 
@@ -66,21 +84,48 @@ func (srv *Server) Init() error {
 		return fmt.Errorf("create listen address error: %v", err)
 	}
 
-	// 构建 libp2p Host
-	host, err := libp2p.New(
-		ctx,
+	// 读取节点数据库中尚未到期的禁止连接记录
+	nodedb, err := openNodeDB(srv.Config.NodeDatabase)
+	if err != nil {
+		return fmt.Errorf("open node database error: %v", err)
+	}
+	srv.lock.Lock()
+	srv.nodedb = nodedb
+	for id, until := range loadBans(nodedb, time.Now()) {
+		srv.banned[id] = until
+	}
+	srv.lock.Unlock()
+
+	// 构建连接管理器, 受信任节点的连接不会被裁剪
+	srv.connMgr = newConnManager(srv.Config.MaxPeers)
+	srv.lock.Lock()
+	for id := range srv.trusted {
+		srv.connMgr.Protect(id, trustedTag)
+	}
+	srv.lock.Unlock()
+
+	// 构建 libp2p Host, 同时创建 KAD_DHT 模块, autorelay 通过 DHT 查找中继节点
+	natOpts, err := natOptions(srv.Config)
+	if err != nil {
+		return err
+	}
+	var kadDHT *kad_dht.IpfsDHT
+	opts := append([]libp2p.Option{
 		libp2p.ListenAddrs(listenAddr),
 		libp2p.Identity(privKey),
-	)
+		libp2p.ConnectionManager(srv.connMgr),
+		libp2p.Routing(func(h host.Host) (rt.PeerRouting, error) {
+			dht, err := kad_dht.New(ctx, h)
+			kadDHT = dht
+			return dht, err
+		}),
+	}, natOpts...)
+	host, err := libp2p.New(ctx, opts...)
 	if err != nil {
 		return fmt.Errorf("new libp2p host error: %v", err)
 	}
 
-	// 启动 KAD_DHT 模块
-	kadDHT, err := kad_dht.New(ctx, host)
-	if err != nil {
-		return fmt.Errorf("new KAD_DHT error: %v", err)
-	}
+	// 启动 KAD_DHT 模块的 bootstrap
 	if err = kadDHT.Bootstrap(ctx); err != nil {
 		return fmt.Errorf("bootstrap KAD_DHT error: %v", err)
 	}
@@ -90,13 +135,24 @@ func (srv *Server) Init() error {
 
 	// 公布自己的身份，等待连接
 	routingDiscovery := discovery.NewRoutingDiscovery(kadDHT)
-	routingDiscovery.Advertise(ctx, TOPIC_PERCEPTION)
-	log.Println("Announcing ourselves")
-	log.Printf("\t <%s> ==> %v \n", host.ID(), TOPIC_PERCEPTION)
+	if !srv.Config.NoDiscovery {
+		routingDiscovery.Advertise(ctx, TOPIC_PERCEPTION)
+		log.Println("Announcing ourselves")
+		log.Printf("\t <%s> ==> %v \n", host.ID(), TOPIC_PERCEPTION)
+	}
 
 	srv.Host = host
 	srv.Routing = kadDHT
 	srv.RoutingDiscovery = routingDiscovery
+	if srv.Config.MDNS {
+		if err := srv.setupMDNS(ctx); err != nil {
+			return err
+		}
+	}
+	if srv.Config.AutoNAT {
+		srv.setupAutoNAT(ctx)
+	}
+	srv.setupPersistentPeers()
 	close(srv.Inited)
 
 	return nil
@@ -109,32 +165,34 @@ func (srv *Server) Start() {
 
 	// 设置协议处理部分
 	host.SetStreamHandler(PROTO_PERCEPTION, srv.streamHandler)
-	go srv.findPeers(ctx, TOPIC_PERCEPTION)
+	if !srv.Config.NoDiscovery {
+		go srv.findPeers(ctx, TOPIC_PERCEPTION)
+	}
+	go srv.staticDialLoop(ctx)
 
 	for {
 		//log.Printf("\t\t server has %d peers. \n", len(srv.Peers))
 		select {
 		case addrInfo := <-srv.peerChan:
-			if _, exists := srv.Peers[addrInfo.ID]; exists {
+			if srv.IsBanned(addrInfo.ID) {
+				continue
+			}
+			// 已经连接或者没有空闲的主动连接槽位时, 不再拨号
+			srv.lock.Lock()
+			err := srv.checkPeerSlots(addrInfo.ID, false)
+			srv.lock.Unlock()
+			if err != nil {
 				continue
 			}
 
 			log.Printf("\t find new peer ==> %v:%v \n", addrInfo.ID, addrInfo.Addrs)
 			// 与同一主题组的 Host 建立连接
-			stream, err := host.NewStream(ctx, addrInfo.ID, PROTO_PERCEPTION)
-			if err != nil {
-				fmt.Printf("Establish a stream to <%v> failed. \n", addrInfo.Addrs)
-				break
+			if err := srv.dialPeer(ctx, addrInfo); err != nil {
+				fmt.Printf("dial peer <%v> failed: %v. \n", addrInfo.Addrs, err)
 			}
-			log.Printf("\t new stream ==> %v \n", stream.Conn().RemoteMultiaddr())
 
-			peer, err := createPeer(stream, srv.ourHandshake, srv.Protocols)
-			if err != nil {
-				fmt.Printf("create p2p Peer error: %v. \n", err)
-				break
-			}
-			srv.Peers[peer.ID] = peer
-			go srv.runPeer(peer, true)
+		case <-srv.quit:
+			return
 		}
 	}
 }
@@ -160,32 +218,42 @@ func (srv *Server) connectBootNodes(ctx context.Context, host host.Host, addrs [
 }
 
 func (srv *Server) findPeers(ctx context.Context, topic string) {
+	// Server 停止时结束查找
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	for {
 		peerChan, err := srv.RoutingDiscovery.FindPeers(ctx, topic)
 		if err != nil {
 			log.Printf("routingDiscovery.FindPeers() error: %v \n", err)
-			continue
-		}
-
-		for addrInfo := range peerChan {
-			if srv.Host.ID() == addrInfo.ID {
-				continue
+		} else {
+			for addrInfo := range peerChan {
+				if srv.Host.ID() == addrInfo.ID {
+					continue
+				}
+
+				//log.Printf("find peer ==> %v:%v \n", addrInfo.ID, addrInfo.Addrs)
+
+				// 将远端地址写入处理管道
+				select {
+				case srv.peerChan <- addrInfo:
+				case <-srv.quit:
+					return
+				}
 			}
+		}
 
-			//log.Printf("find peer ==> %v:%v \n", addrInfo.ID, addrInfo.Addrs)
-
-			// 将远端地址写入处理管道
-			srv.peerChan <- addrInfo
+		select {
+		case <-time.After(10 * time.Second):
+		case <-srv.quit:
+			return
 		}
-		time.Sleep(10 * time.Second)
 	}
-
 }
 
 func createPeer(stream network.Stream, handshake *protoHandshake, protos []Protocol) (*Peer, error) {
 	conn := NewProtoRW(stream)
-	remoteCaps, _, err := fetchRemoteCaps(conn, handshake)
+	remoteCaps, remoteName, err := fetchRemoteCaps(conn, handshake)
 	if err != nil {
 		fmt.Printf("fetch remote peer <%v> caps failed. \n", stream.Conn().RemoteMultiaddr())
 		return nil, err
@@ -195,19 +263,39 @@ func createPeer(stream network.Stream, handshake *protoHandshake, protos []Proto
 		ID:    stream.Conn().RemotePeer(),
 		Addrs: []ma.Multiaddr{stream.Conn().RemoteMultiaddr()},
 	}
-	return newPeer(addrInfo, conn, remoteCaps, protos), nil
+	return newPeer(addrInfo, remoteName, conn, remoteCaps, protos), nil
 
 }
 
 func (srv *Server) streamHandler(stream network.Stream) {
+	if srv.IsBanned(stream.Conn().RemotePeer()) {
+		log.Printf("p2pServer refuse banned peer <%v>", stream.Conn().RemotePeer())
+		stream.Reset()
+		return
+	}
+	// 没有空闲槽位时, 在握手之前通过 discMsg 告知对端
+	srv.lock.Lock()
+	err := srv.checkPeerSlots(stream.Conn().RemotePeer(), true)
+	srv.lock.Unlock()
+	if err != nil {
+		log.Printf("p2pServer refuse inbound peer <%v>: %v", stream.Conn().RemotePeer(), err)
+		NewProtoRW(stream).Close(err)
+		return
+	}
+
 	p, err := createPeer(stream, srv.ourHandshake, srv.Protocols)
 	if err != nil {
 		log.Printf("p2pServer handle stream error: %v", err)
 		return
 	}
 
-	srv.Peers[p.ID] = p
-	go srv.runPeer(p, false)
+	p.inbound = true
+	if err := srv.addPeer(p); err != nil {
+		log.Printf("p2pServer refuse inbound peer <%v>: %v", p.ID, err)
+		p.protoRW.Close(err)
+		return
+	}
+	go srv.runPeer(p)
 }
 
 func (srv *Server) setupLocalNode() error {
@@ -230,20 +318,186 @@ func fetchRemoteCaps(rw *ProtoRW, handshake *protoHandshake) ([]Cap, string, err
 	return remoteHandshake.Caps, remoteHandshake.Name, nil
 }
 
-func (srv *Server) runPeer(p *Peer, initial bool) {
-	if err := p.run(initial); err != nil {
+func (srv *Server) runPeer(p *Peer) {
+	if err := p.run(); err != nil {
 		log.Printf("peer <%v> exit with error: %v\n", p.ID, err)
+		switch err {
+		case errInvalidMsg, errMsgTooLarge:
+			srv.ReportPeer(p.ID, EventProtocolError)
+		case DiscReadTimeout:
+			srv.ReportPeer(p.ID, EventTimeout)
+		}
+	}
+	srv.removePeer(p)
+	srv.staticPeerDropped(p.ID)
+	srv.scorer.Prune()
+	log.Printf("p2p server delete a peer.")
+}
+
+// 断开 id 的连接，并在 duration 时间内拒绝与其建立连接
+func (srv *Server) BanPeer(id peer.ID, duration time.Duration) {
+	srv.banPeer(id, duration, DiscUselessPeer)
+}
+
+// 以 reason 断开 id 的连接并禁止连接, 禁止连接的记录保存在节点数据库中
+func (srv *Server) banPeer(id peer.ID, duration time.Duration, reason DiscReason) {
+	srv.lock.Lock()
+	if srv.trusted[id] {
+		srv.lock.Unlock()
+		log.Printf("p2p server skip banning trusted peer <%v>", id)
+		return
+	}
+	until := time.Now().Add(duration)
+	srv.banned[id] = until
+	if srv.nodedb != nil {
+		storeBan(srv.nodedb, id, until)
 	}
+	p := srv.Peers[id]
+	srv.lock.Unlock()
+
+	log.Printf("p2p server ban peer <%v> for %v: %v", id, duration, reason)
+	if p != nil {
+		go p.Disconnect(reason)
+	}
+}
+
+// 记录节点的行为, 分数低于阈值的节点被断开并禁止连接 peerBanTime
+func (srv *Server) ReportPeer(id peer.ID, ev PeerEvent) {
+	score, ban := srv.scorer.Report(id, ev)
+	if !ban {
+		return
+	}
+	log.Printf("p2p server peer <%v> score %.1f below threshold after %v", id, score, ev)
+	srv.scorer.Forget(id)
+	srv.banPeer(id, peerBanTime, peerEventEffects[ev].reason)
+}
+
+// 返回节点当前的行为分数
+func (srv *Server) PeerScore(id peer.ID) float64 {
+	return srv.scorer.Score(id)
+}
+
+func (srv *Server) IsBanned(id peer.ID) bool {
 	srv.lock.Lock()
 	defer srv.lock.Unlock()
-	defer func() {
-		delete(srv.Peers, p.ID)
-		log.Printf("p2p server delete a peer.")
-	}()
+
+	until, exists := srv.banned[id]
+	if !exists {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(srv.banned, id)
+		if srv.nodedb != nil {
+			deleteBan(srv.nodedb, id)
+		}
+		return false
+	}
+	return true
+}
+
+// 连接 addrInfo 指定的节点, 节点被加入 static 列表, 断开后自动重连
+func (srv *Server) AddPeer(addrInfo peer.AddrInfo) {
+	srv.AddStaticPeer(addrInfo)
+}
+
+// 断开与 id 的连接, 并将其移出 static 列表
+func (srv *Server) RemovePeer(id peer.ID) {
+	srv.lock.Lock()
+	delete(srv.static, id)
+	p := srv.Peers[id]
+	srv.lock.Unlock()
+
+	if p != nil {
+		go p.Disconnect(DiscRequested)
+	}
+	srv.Host.Network().ClosePeer(id)
+}
+
+// 将节点加入信任列表, 受信任的节点不会被禁止连接
+func (srv *Server) AddTrustedPeer(addrInfo peer.AddrInfo) {
+	srv.lock.Lock()
+	srv.trusted[addrInfo.ID] = true
+	delete(srv.banned, addrInfo.ID)
+	if srv.nodedb != nil {
+		deleteBan(srv.nodedb, addrInfo.ID)
+	}
+	srv.lock.Unlock()
+	srv.connMgr.Protect(addrInfo.ID, trustedTag)
+
+	if len(addrInfo.Addrs) > 0 {
+		srv.Host.Peerstore().AddAddrs(addrInfo.ID, addrInfo.Addrs, peerstore.PermanentAddrTTL)
+	}
+}
+
+// 将节点移出信任列表
+func (srv *Server) RemoveTrustedPeer(id peer.ID) {
+	srv.lock.Lock()
+	delete(srv.trusted, id)
+	srv.lock.Unlock()
+	srv.connMgr.Unprotect(id, trustedTag)
+}
+
+// 返回当前连接的全部节点的信息, 按 peer id 排序
+func (srv *Server) PeersInfo() []*PeerInfo {
+	srv.lock.Lock()
+	peers := make([]*Peer, 0, len(srv.Peers))
+	for _, p := range srv.Peers {
+		peers = append(peers, p)
+	}
+	srv.lock.Unlock()
+
+	infos := make([]*PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		info := p.Info()
+		info.Network.Latency = srv.Host.Peerstore().LatencyEWMA(p.ID).String()
+		srv.lock.Lock()
+		info.Network.Trusted = srv.trusted[p.ID]
+		srv.lock.Unlock()
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// NodeInfo 是 admin_nodeInfo 返回的本地节点信息
+type NodeInfo struct {
+	ID           string                 `json:"id"`           // libp2p peer id
+	Name         string                 `json:"name"`         // 握手时声明的名字
+	ListenAddrs  []string               `json:"listenAddrs"`  // 包含 /p2p/<id> 的完整监听地址
+	Reachability string                 `json:"reachability"` // AutoNAT 检测到的可达性
+	Protocols    map[string]interface{} `json:"protocols"`    // 支持的协议以及协议相关的信息
+}
+
+// 收集本地节点的基本信息, 以及各个协议提供的信息
+func (srv *Server) NodeInfo() *NodeInfo {
+	info := &NodeInfo{
+		ID:           srv.Host.ID().Pretty(),
+		Name:         srv.Config.Name,
+		Reachability: srv.Reachability(),
+		Protocols:    make(map[string]interface{}),
+	}
+	for _, addr := range srv.Host.Addrs() {
+		info.ListenAddrs = append(info.ListenAddrs, fmt.Sprintf("%s/p2p/%s", addr, info.ID))
+	}
+	for _, proto := range srv.Protocols {
+		if _, ok := info.Protocols[proto.Name]; ok {
+			continue
+		}
+		nodeInfo := interface{}("unknown")
+		if query := proto.NodeInfo; query != nil {
+			nodeInfo = query()
+		}
+		info.Protocols[proto.Name] = nodeInfo
+	}
+	return info
 }
 
 func (srv *Server) Stop() {
+	close(srv.quit)
 	srv.lock.Lock()
 	srv.Host.Close()
+	if srv.nodedb != nil {
+		srv.nodedb.Close()
+	}
 	srv.lock.Unlock()
 }
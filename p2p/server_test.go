@@ -1,7 +1,6 @@
 package p2p
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"os"
@@ -9,10 +8,6 @@ import (
 	"time"
 
 	crypto "github.com/libp2p/go-libp2p-core/crypto"
-	"github.com/libp2p/go-libp2p-core/host"
-	"github.com/libp2p/go-libp2p-core/network"
-	"github.com/libp2p/go-libp2p-core/peer"
-	"github.com/libp2p/go-libp2p-core/protocol"
 )
 
 func TestServer(t *testing.T) {
@@ -53,14 +48,13 @@ func makeServer(name string, listenAddr string, keyfile string) *Server {
 	server.Init()
 
 	// 构建一个测试的协议模块
-	svc := makeDummyService("DummyService", 1, server.Host)
-	svc.Init(server)
-
+	svc := makeDummyService("DummyService", 1)
 	server.Protocols = append(server.Protocols, Protocol{
 		Name:    "DummyService",
 		Version: 1,
-		Run: func(remoteID peer.ID, initial bool) error {
-			err := svc.StartTalk(remoteID, initial)
+		Length:  1,
+		Run: func(p *Peer, rw MsgReadWriter) error {
+			err := svc.StartTalk(p, rw)
 			fmt.Printf("Protocol.Run() error: %v \n", err)
 			return err
 		},
@@ -91,65 +85,37 @@ func fillPrivateKey(config *Config, keyfilePath string) error {
 type DummyService struct {
 	Name    string
 	Version uint
-	peers   map[peer.ID]*Peer
-	host    host.Host
 }
 
-func makeDummyService(name string, version uint, host host.Host) *DummyService {
+func makeDummyService(name string, version uint) *DummyService {
 	return &DummyService{
 		Name:    name,
 		Version: version,
-		peers:   make(map[peer.ID]*Peer),
-		host:    host,
 	}
 }
 
-func (ps *DummyService) Init(server *Server) {
-	server.Host.SetStreamHandler(ps.ProtocolID(), ps.StreamHandler)
-}
-
-func (ps *DummyService) StreamHandler(stream network.Stream) {
-	go func() {
-		rw := NewProtoRW(stream)
+// 主动连接的一方周期性地发送消息, 另一方原样返回
+func (ps *DummyService) StartTalk(p *Peer, rw MsgReadWriter) error {
+	if p.Inbound() {
 		for {
 			msg, err := rw.ReadMsg()
 			if err != nil {
-				fmt.Printf("DummyService.StreamHandler, read msg error: %v \n", err)
+				return err
 			}
-
-			err = rw.WriteMsg(msg)
-			if err != nil {
-				fmt.Printf("DummyService.StreamHandler, write msg error: %v \n", err)
+			if err := rw.WriteMsg(msg); err != nil {
+				return err
 			}
 		}
-	}()
-}
-
-func (ps *DummyService) ProtocolID() protocol.ID {
-	return protocol.ID(fmt.Sprintf("/%s/%d", ps.Name, ps.Version))
-}
-
-func (ps *DummyService) StartTalk(remoteID peer.ID, initial bool) error {
-
-	if _, exists := ps.peers[remoteID]; !exists {
-		if !initial {
-			return nil
-		}
+	}
 
-		fmt.Println("begin new stream from proton/1 ...")
-		ProtocolID := protocol.ID(fmt.Sprintf("/%s/%d", ps.Name, ps.Version))
-		stream, err := ps.host.NewStream(context.Background(), remoteID, ProtocolID)
-		if err != nil {
+	log.Printf("\t\t start talking to %v \n", p.ID)
+	for {
+		if err := Send(rw, 0, "Dummy Service Msg."); err != nil {
 			return err
 		}
-		log.Printf("\t\t initial new stream(%v) to %v \n", ProtocolID, remoteID.String())
-		rw := NewProtoRW(stream)
-		for {
-			if err := Send(rw, uint64(44), "Dummy Service Msg."); err != nil {
-				fmt.Printf("DummyService send msg error: %v \n", err)
-			}
-			time.Sleep(3 * time.Second)
+		if _, err := rw.ReadMsg(); err != nil {
+			return err
 		}
+		time.Sleep(3 * time.Second)
 	}
-	return nil
 }
@@ -0,0 +1,120 @@
+package p2p
+
+import (
+	"time"
+
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// 默认 1/3 的槽位用于主动连接
+	defaultDialRatio = 3
+
+	// 新建立的连接在宽限期内不会被连接管理器裁剪
+	connMgrGracePeriod = time.Minute
+
+	// 完成 perception 握手的连接在连接管理器中的标签和权重,
+	// 没有标签的连接 (例如只用于 DHT 的连接) 会被优先裁剪
+	peerTag      = "perception-peer"
+	peerTagValue = 100
+
+	// 受信任节点的连接不会被连接管理器裁剪
+	trustedTag = "perception-trusted"
+)
+
+// 创建 libp2p 连接管理器, 连接数超过 2*MaxPeers 时裁剪到 MaxPeers
+func newConnManager(maxPeers int) *connmgr.BasicConnMgr {
+	return connmgr.NewConnManager(maxPeers, 2*maxPeers, connMgrGracePeriod)
+}
+
+// 主动连接的槽位数
+func (srv *Server) maxDialedConns() int {
+	if srv.Config.MaxPeers <= 0 {
+		return 0
+	}
+	ratio := srv.Config.DialRatio
+	if ratio <= 0 {
+		ratio = defaultDialRatio
+	}
+	limit := srv.Config.MaxPeers / ratio
+	if limit == 0 {
+		limit = 1
+	}
+	return limit
+}
+
+// 对端发起的连接的槽位数
+func (srv *Server) maxInboundConns() int {
+	return srv.Config.MaxPeers - srv.maxDialedConns()
+}
+
+// 检查是否可以接受与 id 的连接, 调用者需要持有 srv.lock.
+// 受信任的节点不占用槽位, 也不受槽位的限制; static 节点不受主动连接槽位的限制.
+func (srv *Server) checkPeerSlots(id peer.ID, inbound bool) error {
+	switch {
+	case srv.Host != nil && id == srv.Host.ID():
+		return DiscSelf
+	case srv.Peers[id] != nil:
+		return DiscAlreadyConnected
+	case srv.trusted[id]:
+		return nil
+	}
+
+	var inboundCount, dialedCount int
+	for _, p := range srv.Peers {
+		if srv.trusted[p.ID] {
+			continue
+		}
+		if p.inbound {
+			inboundCount++
+		} else {
+			dialedCount++
+		}
+	}
+	switch {
+	case inboundCount+dialedCount >= srv.Config.MaxPeers:
+		return DiscTooManyPeers
+	case inbound && inboundCount >= srv.maxInboundConns():
+		return DiscTooManyPeers
+	case !inbound && dialedCount >= srv.maxDialedConns() && srv.static[id] == nil:
+		return DiscTooManyPeers
+	}
+	return nil
+}
+
+// 在槽位允许的情况下登记节点
+func (srv *Server) addPeer(p *Peer) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if err := srv.checkPeerSlots(p.ID, p.inbound); err != nil {
+		return err
+	}
+	srv.Peers[p.ID] = p
+	if srv.connMgr != nil {
+		srv.connMgr.TagPeer(p.ID, peerTag, peerTagValue)
+	}
+	return nil
+}
+
+// 注销节点, 释放其占用的槽位
+func (srv *Server) removePeer(p *Peer) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if srv.Peers[p.ID] == p {
+		delete(srv.Peers, p.ID)
+		if srv.connMgr != nil {
+			srv.connMgr.UntagPeer(p.ID, peerTag)
+		}
+	}
+}
+
+// 节点是否在信任列表中
+func (srv *Server) IsTrusted(id peer.ID) bool {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	return srv.trusted[id]
+}
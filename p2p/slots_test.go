@@ -0,0 +1,70 @@
+package p2p
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func testPeerID(i int) peer.ID {
+	return peer.ID(fmt.Sprintf("peer-%d", i))
+}
+
+func TestPeerSlots(t *testing.T) {
+	srv := NewServer(&Config{MaxPeers: 6})
+	if srv.maxDialedConns() != 2 || srv.maxInboundConns() != 4 {
+		t.Fatalf("slots mismatch: dialed %d, inbound %d", srv.maxDialedConns(), srv.maxInboundConns())
+	}
+
+	// 主动连接的槽位用完后, 仍然可以接受对端发起的连接
+	for i := 0; i < 2; i++ {
+		if err := srv.addPeer(&Peer{ID: testPeerID(i)}); err != nil {
+			t.Fatalf("dialed peer %d refused: %v", i, err)
+		}
+	}
+	if err := srv.addPeer(&Peer{ID: testPeerID(2)}); err != DiscTooManyPeers {
+		t.Errorf("error mismatch: have %v, want %v", err, DiscTooManyPeers)
+	}
+	for i := 2; i < 6; i++ {
+		if err := srv.addPeer(&Peer{ID: testPeerID(i), inbound: true}); err != nil {
+			t.Fatalf("inbound peer %d refused: %v", i, err)
+		}
+	}
+	if err := srv.addPeer(&Peer{ID: testPeerID(6), inbound: true}); err != DiscTooManyPeers {
+		t.Errorf("error mismatch: have %v, want %v", err, DiscTooManyPeers)
+	}
+	if err := srv.addPeer(&Peer{ID: testPeerID(0), inbound: true}); err != DiscAlreadyConnected {
+		t.Errorf("error mismatch: have %v, want %v", err, DiscAlreadyConnected)
+	}
+
+	// 受信任的节点不受槽位限制, 也不占用槽位
+	srv.trusted[testPeerID(7)] = true
+	if err := srv.addPeer(&Peer{ID: testPeerID(7), inbound: true}); err != nil {
+		t.Errorf("trusted peer refused: %v", err)
+	}
+
+	// 节点断开后槽位被释放
+	srv.removePeer(srv.Peers[testPeerID(3)])
+	if err := srv.addPeer(&Peer{ID: testPeerID(6), inbound: true}); err != nil {
+		t.Errorf("inbound peer refused after slot freed: %v", err)
+	}
+}
+
+func TestPeerSlotsDialRatio(t *testing.T) {
+	tests := []struct {
+		maxPeers, ratio int
+		dialed, inbound int
+	}{
+		{50, 0, 16, 34},
+		{50, 2, 25, 25},
+		{1, 0, 1, 0},
+		{0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		srv := NewServer(&Config{MaxPeers: tt.maxPeers, DialRatio: tt.ratio})
+		if dialed, inbound := srv.maxDialedConns(), srv.maxInboundConns(); dialed != tt.dialed || inbound != tt.inbound {
+			t.Errorf("MaxPeers %d, DialRatio %d: have (%d, %d), want (%d, %d)", tt.maxPeers, tt.ratio, dialed, inbound, tt.dialed, tt.inbound)
+		}
+	}
+}
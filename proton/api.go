@@ -0,0 +1,346 @@
+package proton
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/proton/chaindb"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/rawdb"
+	"github.com/czh0526/perception/proton/core/state"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rlp"
+	"github.com/czh0526/perception/rpc"
+)
+
+// PublicBlockChainAPI 提供区块链数据的只读查询, 注册在 proton 命名空间下
+type PublicBlockChainAPI struct {
+	chainID    uint64
+	blockchain *core.BlockChain
+}
+
+func NewPublicBlockChainAPI(proton *Proton) *PublicBlockChainAPI {
+	return &PublicBlockChainAPI{
+		chainID:    proton.networkID,
+		blockchain: proton.blockchain,
+	}
+}
+
+// ChainId 返回当前链的标识, 即启动时配置的 networkid
+func (api *PublicBlockChainAPI) ChainId() hexutil.Uint64 {
+	return hexutil.Uint64(api.chainID)
+}
+
+// BlockNumber 返回当前链头的区块编号
+func (api *PublicBlockChainAPI) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(api.blockchain.CurrentBlock().NumberU64())
+}
+
+// GetBalance 返回账户在指定区块状态下的余额
+func (api *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*hexutil.Big, error) {
+	statedb, _, err := api.stateAndHeaderByNumber(blockNr)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(statedb.GetBalance(address)), nil
+}
+
+// GetNonce 返回账户在指定区块状态下的 nonce
+func (api *PublicBlockChainAPI) GetNonce(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*hexutil.Uint64, error) {
+	statedb, _, err := api.stateAndHeaderByNumber(blockNr)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	nonce := statedb.GetNonce(address)
+	return (*hexutil.Uint64)(&nonce), nil
+}
+
+// GetCode 返回账户在指定区块状态下的合约代码
+func (api *PublicBlockChainAPI) GetCode(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
+	statedb, _, err := api.stateAndHeaderByNumber(blockNr)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	return statedb.GetCode(address), nil
+}
+
+// GetStorageAt 返回账户在指定区块状态下某个存储位置的值
+func (api *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.Address, key string, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
+	statedb, _, err := api.stateAndHeaderByNumber(blockNr)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	value := statedb.GetState(address, common.HexToHash(key))
+	return value[:], nil
+}
+
+// GetHeaderByNumber 返回指定编号的区块头, 区块不存在时返回 null
+func (api *PublicBlockChainAPI) GetHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) map[string]interface{} {
+	header := api.headerByNumber(blockNr)
+	if header == nil {
+		return nil
+	}
+	return RPCMarshalHeader(header)
+}
+
+// GetHeaderByHash 返回指定哈希的区块头, 区块不存在时返回 null
+func (api *PublicBlockChainAPI) GetHeaderByHash(ctx context.Context, hash common.Hash) map[string]interface{} {
+	header := api.blockchain.GetHeaderByHash(hash)
+	if header == nil {
+		return nil
+	}
+	return RPCMarshalHeader(header)
+}
+
+// GetBlockByNumber 返回指定编号的区块, fullTx 为 true 时返回完整的交易, 否则只返回交易哈希
+func (api *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, fullTx bool) map[string]interface{} {
+	block := api.blockByNumber(blockNr)
+	if block == nil {
+		return nil
+	}
+	return RPCMarshalBlock(block, true, fullTx)
+}
+
+// GetBlockByHash 返回指定哈希的区块, fullTx 为 true 时返回完整的交易, 否则只返回交易哈希
+func (api *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, hash common.Hash, fullTx bool) map[string]interface{} {
+	block := api.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		return nil
+	}
+	return RPCMarshalBlock(block, true, fullTx)
+}
+
+// AccountResult 是 proton_getProof 的返回值.
+// AccountProof 是账户在 state trie 中的 proof, 从根节点开始依次排列, 每个节点为 rlp 编码的十六进制字符串,
+// 节点以 keccak256(address) 为路径; StorageProof 依次对应请求中的每个 storage key.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult 是单个存储项的 proof, Proof 以 keccak256(key) 为路径, 根节点为 AccountResult.StorageHash
+type StorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+// GetProof 返回账户以及指定存储项在指定区块状态下的 merkle proof, 可以用 VerifyProof 对照区块头的 stateRoot 校验
+func (api *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
+	statedb, _, err := api.stateAndHeaderByNumber(blockNr)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+
+	storageHash := statedb.GetStorageRoot(address)
+	storageProof := make([]StorageResult, len(storageKeys))
+	for i, key := range storageKeys {
+		// 账户不存在时, storage trie 为空, 只需要返回空的 proof
+		if storageHash == emptyStorageRoot {
+			storageProof[i] = StorageResult{key, &hexutil.Big{}, []string{}}
+			continue
+		}
+		proof, err := statedb.GetStorageProof(address, common.HexToHash(key))
+		if err != nil {
+			return nil, err
+		}
+		value := statedb.GetState(address, common.HexToHash(key))
+		storageProof[i] = StorageResult{key, (*hexutil.Big)(value.Big()), toHexSlice(proof)}
+	}
+
+	accountProof, err := statedb.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(accountProof),
+		Balance:      (*hexutil.Big)(statedb.GetBalance(address)),
+		CodeHash:     statedb.GetCodeHash(address),
+		Nonce:        hexutil.Uint64(statedb.GetNonce(address)),
+		StorageHash:  storageHash,
+		StorageProof: storageProof,
+	}, nil
+}
+
+func toHexSlice(b [][]byte) []string {
+	r := make([]string, len(b))
+	for i := range b {
+		r[i] = hexutil.Encode(b[i])
+	}
+	return r
+}
+
+// pending 和 latest 都指向当前链头, 目前还没有 pending 区块
+func (api *PublicBlockChainAPI) headerByNumber(blockNr rpc.BlockNumber) *types.Header {
+	if blockNr == rpc.PendingBlockNumber || blockNr == rpc.LatestBlockNumber {
+		return api.blockchain.CurrentBlock().Header()
+	}
+	return api.blockchain.GetHeaderByNumber(uint64(blockNr))
+}
+
+func (api *PublicBlockChainAPI) blockByNumber(blockNr rpc.BlockNumber) *types.Block {
+	if blockNr == rpc.PendingBlockNumber || blockNr == rpc.LatestBlockNumber {
+		return api.blockchain.CurrentBlock()
+	}
+	return api.blockchain.GetBlockByNumber(uint64(blockNr))
+}
+
+func (api *PublicBlockChainAPI) stateAndHeaderByNumber(blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	header := api.headerByNumber(blockNr)
+	if header == nil {
+		return nil, nil, fmt.Errorf("block #%d not found", blockNr)
+	}
+	statedb, err := api.blockchain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+// RPCMarshalHeader 将区块头转换为 RPC 应答的格式
+func RPCMarshalHeader(head *types.Header) map[string]interface{} {
+	return map[string]interface{}{
+		"number":           (*hexutil.Big)(head.Number),
+		"hash":             head.Hash(),
+		"parentHash":       head.ParentHash,
+		"stateRoot":        head.Root,
+		"transactionsRoot": head.TxHash,
+		"timestamp":        hexutil.Uint64(head.Time),
+	}
+}
+
+// RPCMarshalBlock 将区块转换为 RPC 应答的格式, inclTx 为 true 时包含交易,
+// fullTx 为 true 时返回完整的交易, 否则只返回交易哈希
+func RPCMarshalBlock(block *types.Block, inclTx bool, fullTx bool) map[string]interface{} {
+	fields := RPCMarshalHeader(block.Header())
+
+	if inclTx {
+		formatTx := func(tx *types.Transaction, index int) interface{} {
+			return tx.Hash()
+		}
+		if fullTx {
+			formatTx = func(tx *types.Transaction, index int) interface{} {
+				return newRPCTransaction(tx, block.Hash(), block.NumberU64(), uint64(index))
+			}
+		}
+		txs := block.Transactions()
+		transactions := make([]interface{}, len(txs))
+		for i, tx := range txs {
+			transactions[i] = formatTx(tx, i)
+		}
+		fields["transactions"] = transactions
+	}
+	return fields
+}
+
+// RPCTransaction 是交易在 RPC 应答中的格式
+type RPCTransaction struct {
+	BlockHash        *common.Hash    `json:"blockHash"`
+	BlockNumber      *hexutil.Big    `json:"blockNumber"`
+	Hash             common.Hash     `json:"hash"`
+	Data             string          `json:"data"`
+	TransactionIndex *hexutil.Uint64 `json:"transactionIndex"`
+}
+
+// newRPCTransaction 构造 RPCTransaction, blockHash 为空时表示交易尚未打包
+func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCTransaction {
+	result := &RPCTransaction{
+		Hash: tx.Hash(),
+		Data: tx.Data(),
+	}
+	if blockHash != (common.Hash{}) {
+		result.BlockHash = &blockHash
+		result.BlockNumber = (*hexutil.Big)(new(big.Int).SetUint64(blockNumber))
+		result.TransactionIndex = (*hexutil.Uint64)(&index)
+	}
+	return result
+}
+
+// PublicTransactionPoolAPI 提供交易的提交和查询, 注册在 proton 命名空间下
+type PublicTransactionPoolAPI struct {
+	chainDb    chaindb.Database
+	blockchain *core.BlockChain
+	txPool     *core.TxPool
+}
+
+func NewPublicTransactionPoolAPI(proton *Proton) *PublicTransactionPoolAPI {
+	return &PublicTransactionPoolAPI{
+		chainDb:    proton.chainDb,
+		blockchain: proton.blockchain,
+		txPool:     proton.txPool,
+	}
+}
+
+// SendRawTransaction 解码 rlp 编码的交易, 校验后加入交易池, 返回交易的哈希
+func (api *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encodedTx hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+		return common.Hash{}, err
+	}
+	if err := api.txPool.AddLocal(tx); err != nil {
+		return common.Hash{}, err
+	}
+	log.Printf("Submitted transaction, hash = 0x%x", tx.Hash())
+	return tx.Hash(), nil
+}
+
+// GetTransactionByHash 先在 canonical 区块中查找交易, 找不到再查找交易池, 都不存在时返回 null
+func (api *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, hash common.Hash) *RPCTransaction {
+	if tx, blockHash, blockNumber, index := rawdb.ReadTransaction(api.chainDb, hash); tx != nil {
+		return newRPCTransaction(tx, blockHash, blockNumber, index)
+	}
+	if tx := api.txPool.Get(hash); tx != nil {
+		return newRPCTransaction(tx, common.Hash{}, 0, 0)
+	}
+	return nil
+}
+
+// GetTransactionReceipt 返回已打包交易的收据, 交易尚未打包时返回 null.
+// 目前区块中的交易不会被执行, 所以收据中的 status 总是 1.
+func (api *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(api.chainDb, hash)
+	if tx == nil {
+		return nil, nil
+	}
+	return map[string]interface{}{
+		"transactionHash":  hash,
+		"transactionIndex": hexutil.Uint64(index),
+		"blockHash":        blockHash,
+		"blockNumber":      hexutil.Uint64(blockNumber),
+		"status":           hexutil.Uint(1),
+	}, nil
+}
+
+// PendingTransactions 返回交易池中尚未被打包的交易
+func (api *PublicTransactionPoolAPI) PendingTransactions() []*RPCTransaction {
+	pending := api.txPool.Pending()
+	txs := make([]*RPCTransaction, len(pending))
+	for i, tx := range pending {
+		txs[i] = newRPCTransaction(tx, common.Hash{}, 0, 0)
+	}
+	return txs
+}
+
+// GetTransactionCount 返回账户在指定区块状态下的 nonce.
+// 交易目前不包含发送者, 所以 pending 与 latest 的结果相同.
+func (api *PublicTransactionPoolAPI) GetTransactionCount(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*hexutil.Uint64, error) {
+	header := api.blockchain.CurrentBlock().Header()
+	if blockNr != rpc.PendingBlockNumber && blockNr != rpc.LatestBlockNumber {
+		if header = api.blockchain.GetHeaderByNumber(uint64(blockNr)); header == nil {
+			return nil, fmt.Errorf("block #%d not found", blockNr)
+		}
+	}
+	statedb, err := api.blockchain.StateAt(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	nonce := statedb.GetNonce(address)
+	return (*hexutil.Uint64)(&nonce), nil
+}
@@ -0,0 +1,28 @@
+package proton
+
+import (
+	"github.com/czh0526/perception/event"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/types"
+)
+
+// ProtonAPIBackend 将区块链和交易池的事件提供给 RPC 服务
+type ProtonAPIBackend struct {
+	proton *Proton
+}
+
+func (b *ProtonAPIBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return b.proton.txPool.SubscribeNewTxsEvent(ch)
+}
+
+func (b *ProtonAPIBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.proton.blockchain.SubscribeChainHeadEvent(ch)
+}
+
+func (b *ProtonAPIBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return b.proton.blockchain.SubscribeLogsEvent(ch)
+}
+
+func (b *ProtonAPIBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
+	return b.proton.blockchain.SubscribeRemovedLogsEvent(ch)
+}
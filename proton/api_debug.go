@@ -0,0 +1,223 @@
+package proton
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/state"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/proton/trie"
+	"github.com/czh0526/perception/rlp"
+	"github.com/czh0526/perception/rpc"
+)
+
+// AccountRangeMaxResults 是 debug_accountRange 一次最多返回的账户数
+const AccountRangeMaxResults = 256
+
+// PublicDebugAPI 提供状态的只读调试接口, 注册在 debug 命名空间下
+type PublicDebugAPI struct {
+	blockchain *core.BlockChain
+}
+
+func NewPublicDebugAPI(proton *Proton) *PublicDebugAPI {
+	return &PublicDebugAPI{blockchain: proton.blockchain}
+}
+
+// DumpBlock 返回指定区块状态下全部账户的余额, nonce, 代码和存储
+func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error) {
+	header, err := headerByNumber(api.blockchain, blockNr)
+	if err != nil {
+		return state.Dump{}, err
+	}
+	statedb, err := api.blockchain.StateAt(header.Root)
+	if err != nil {
+		return state.Dump{}, err
+	}
+	return statedb.RawDump(false, false), nil
+}
+
+// PrivateDebugAPI 提供状态和链头的调试接口, 注册在 debug 命名空间下
+type PrivateDebugAPI struct {
+	blockchain *core.BlockChain
+}
+
+func NewPrivateDebugAPI(proton *Proton) *PrivateDebugAPI {
+	return &PrivateDebugAPI{blockchain: proton.blockchain}
+}
+
+// AccountRange 从 secure key start 开始分页返回指定区块状态下的账户,
+// 返回值中的 next 作为下一页的 start, 为空时表示已经遍历完
+func (api *PrivateDebugAPI) AccountRange(blockNr rpc.BlockNumber, start hexutil.Bytes, maxResults int, nocode, nostorage bool) (state.IteratorDump, error) {
+	header, err := headerByNumber(api.blockchain, blockNr)
+	if err != nil {
+		return state.IteratorDump{}, err
+	}
+	statedb, err := api.blockchain.StateAt(header.Root)
+	if err != nil {
+		return state.IteratorDump{}, err
+	}
+	if maxResults > AccountRangeMaxResults || maxResults <= 0 {
+		maxResults = AccountRangeMaxResults
+	}
+	return statedb.IteratorDump(start, maxResults, nocode, nostorage), nil
+}
+
+// StorageRangeResult 是 debug_storageRangeAt 的返回值, NextKey 为空时表示已经遍历完
+type StorageRangeResult struct {
+	Storage storageMap   `json:"storage"`
+	NextKey *common.Hash `json:"nextKey"`
+}
+
+type storageMap map[common.Hash]storageEntry
+
+type storageEntry struct {
+	Key   *common.Hash `json:"key"`
+	Value common.Hash  `json:"value"`
+}
+
+// StorageRangeAt 从 secure key keyStart 开始返回合约在指定区块状态下最多 maxResult 个存储项.
+// 目前区块中的交易不会被执行, 所以 txIndex 不影响结果, 保留该参数只是为了兼容调用方.
+func (api *PrivateDebugAPI) StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
+	header := api.blockchain.GetHeaderByHash(blockHash)
+	if header == nil {
+		return StorageRangeResult{}, fmt.Errorf("block %#x not found", blockHash)
+	}
+	statedb, err := api.blockchain.StateAt(header.Root)
+	if err != nil {
+		return StorageRangeResult{}, err
+	}
+	st := statedb.StorageTrie(contractAddress)
+	if st == nil {
+		return StorageRangeResult{}, fmt.Errorf("account %x doesn't exist", contractAddress)
+	}
+	return storageRangeAt(st, keyStart, maxResult)
+}
+
+func storageRangeAt(st state.Trie, start []byte, maxResult int) (StorageRangeResult, error) {
+	it := trie.NewIterator(st.NodeIterator(start))
+	result := StorageRangeResult{Storage: storageMap{}}
+	for i := 0; i < maxResult && it.Next(); i++ {
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return StorageRangeResult{}, err
+		}
+		e := storageEntry{Value: common.BytesToHash(content)}
+		if preimage := st.GetKey(it.Key); preimage != nil {
+			preimage := common.BytesToHash(preimage)
+			e.Key = &preimage
+		}
+		result.Storage[common.BytesToHash(it.Key)] = e
+	}
+	// 还有剩余的存储项时, 返回下一项的 key
+	if it.Next() {
+		next := common.BytesToHash(it.Key)
+		result.NextKey = &next
+	}
+	return result, nil
+}
+
+// GetModifiedAccounts 返回区块 startNum 到 endNum 之间状态发生变化的账户,
+// endNum 为空时只比较 startNum 与其父区块
+func (api *PrivateDebugAPI) GetModifiedAccounts(startNum uint64, endNum *uint64) ([]common.Address, error) {
+	var startBlock, endBlock *types.Block
+
+	startBlock = api.blockchain.GetBlockByNumber(startNum)
+	if startBlock == nil {
+		return nil, fmt.Errorf("start block #%d not found", startNum)
+	}
+
+	if endNum == nil {
+		endBlock = startBlock
+		startBlock = api.blockchain.GetBlockByHash(startBlock.ParentHash())
+		if startBlock == nil {
+			return nil, fmt.Errorf("block #%d has no parent", endBlock.NumberU64())
+		}
+	} else {
+		endBlock = api.blockchain.GetBlockByNumber(*endNum)
+		if endBlock == nil {
+			return nil, fmt.Errorf("end block #%d not found", *endNum)
+		}
+	}
+	return api.getModifiedAccounts(startBlock, endBlock)
+}
+
+// 用 difference iterator 找出 endBlock 的 state trie 中与 startBlock 不同的账户
+func (api *PrivateDebugAPI) getModifiedAccounts(startBlock, endBlock *types.Block) ([]common.Address, error) {
+	if startBlock.NumberU64() >= endBlock.NumberU64() {
+		return nil, fmt.Errorf("start block height (%d) must be less than end block height (%d)", startBlock.NumberU64(), endBlock.NumberU64())
+	}
+	triedb := api.blockchain.StateCache()
+
+	oldTrie, err := triedb.OpenTrie(startBlock.Root())
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := triedb.OpenTrie(endBlock.Root())
+	if err != nil {
+		return nil, err
+	}
+	diff, _ := trie.NewDifferenceIterator(oldTrie.NodeIterator([]byte{}), newTrie.NodeIterator([]byte{}))
+	iter := trie.NewIterator(diff)
+
+	var dirty []common.Address
+	for iter.Next() {
+		key := newTrie.GetKey(iter.Key)
+		if key == nil {
+			return nil, fmt.Errorf("no preimage found for hash %x", iter.Key)
+		}
+		dirty = append(dirty, common.BytesToAddress(key))
+	}
+	return dirty, nil
+}
+
+// SetHead 将本地链头回退到指定的区块编号
+func (api *PrivateDebugAPI) SetHead(number hexutil.Uint64) error {
+	if uint64(number) > api.blockchain.CurrentBlock().NumberU64() {
+		return errors.New("cannot set head beyond the current head")
+	}
+	return api.blockchain.SetHead(uint64(number))
+}
+
+// BadBlockArgs 是 debug_getBadBlocks 返回的 bad block
+type BadBlockArgs struct {
+	Hash   common.Hash            `json:"hash"`
+	Number hexutil.Uint64         `json:"number"`
+	Reason string                 `json:"reason"` // 校验失败的原因
+	Peer   string                 `json:"peer"`   // 提供该区块的节点
+	Time   hexutil.Uint64         `json:"time"`   // 记录的时间 (unix 秒)
+	Block  map[string]interface{} `json:"block"`
+}
+
+// GetBadBlocks 返回最近校验失败的区块, 按区块编号从高到低排列
+func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]*BadBlockArgs, error) {
+	badBlocks := api.blockchain.BadBlocks()
+	results := make([]*BadBlockArgs, 0, len(badBlocks))
+	for _, bad := range badBlocks {
+		block := bad.Block()
+		results = append(results, &BadBlockArgs{
+			Hash:   block.Hash(),
+			Number: hexutil.Uint64(block.NumberU64()),
+			Reason: bad.Reason,
+			Peer:   bad.Peer,
+			Time:   hexutil.Uint64(bad.Time),
+			Block:  RPCMarshalBlock(block, true, true),
+		})
+	}
+	return results, nil
+}
+
+// pending 和 latest 都指向当前链头, 目前还没有 pending 区块
+func headerByNumber(bc *core.BlockChain, blockNr rpc.BlockNumber) (*types.Header, error) {
+	if blockNr == rpc.PendingBlockNumber || blockNr == rpc.LatestBlockNumber {
+		return bc.CurrentBlock().Header(), nil
+	}
+	header := bc.GetHeaderByNumber(uint64(blockNr))
+	if header == nil {
+		return nil, fmt.Errorf("block #%d not found", blockNr)
+	}
+	return header, nil
+}
@@ -0,0 +1,192 @@
+package proton
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/state"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rpc"
+)
+
+func TestDebugAPIDumpBlock(t *testing.T) {
+	proton, _ := newTestProton(t, 1)
+	api := NewPublicDebugAPI(proton)
+
+	dump, err := api.DumpBlock(rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to dump block: %v", err)
+	}
+	account, ok := dump.Accounts[testAddr.Hex()]
+	if !ok {
+		t.Fatalf("account %x missing from dump: %v", testAddr, dump.Accounts)
+	}
+	if account.Balance != "1000" || account.Nonce != 3 {
+		t.Errorf("account mismatch: have balance %s nonce %d", account.Balance, account.Nonce)
+	}
+	if account.Code != common.Bytes2Hex(testCode) {
+		t.Errorf("code mismatch: have %s, want %x", account.Code, testCode)
+	}
+	if value := account.Storage[testKey]; value != "ff" {
+		t.Errorf("storage mismatch: have %q, want %q", value, "ff")
+	}
+	if _, err := api.DumpBlock(10); err == nil {
+		t.Errorf("expected error for missing block")
+	}
+}
+
+func TestDebugAPIRanges(t *testing.T) {
+	proton, blocks := newTestProton(t, 1)
+	api := NewPrivateDebugAPI(proton)
+
+	dump, err := api.AccountRange(rpc.LatestBlockNumber, nil, 0, true, true)
+	if err != nil {
+		t.Fatalf("failed to get account range: %v", err)
+	}
+	if len(dump.Accounts) != 1 || dump.Next != nil {
+		t.Fatalf("account range mismatch: have %v, next %x", dump.Accounts, dump.Next)
+	}
+	if account := dump.Accounts[testAddr.Hex()]; account.Code != "" || account.Storage != nil {
+		t.Errorf("code and storage not excluded: %+v", account)
+	}
+
+	result, err := api.StorageRangeAt(context.Background(), blocks[1].Hash(), 0, testAddr, nil, 10)
+	if err != nil {
+		t.Fatalf("failed to get storage range: %v", err)
+	}
+	if len(result.Storage) != 1 || result.NextKey != nil {
+		t.Fatalf("storage range mismatch: have %v, next %v", result.Storage, result.NextKey)
+	}
+	for _, entry := range result.Storage {
+		if entry.Key == nil || *entry.Key != testKey || entry.Value != common.BytesToHash([]byte{0xff}) {
+			t.Errorf("storage entry mismatch: have %+v", entry)
+		}
+	}
+	if _, err := api.StorageRangeAt(context.Background(), blocks[1].Hash(), 0, common.Address{0xaa}, nil, 10); err == nil {
+		t.Errorf("expected error for missing account")
+	}
+}
+
+func TestDebugAPIAccountRangePaging(t *testing.T) {
+	other := common.BytesToAddress([]byte{2})
+	proton, _ := newTestProtonWithGenesis(t, &core.Genesis{Alloc: core.GenesisAlloc{
+		testAddr: {Balance: big.NewInt(1000)},
+		other:    {Balance: big.NewInt(2000)},
+	}}, 1)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("debug", NewPrivateDebugAPI(proton)); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer server.Stop()
+	defer client.Close()
+
+	// 第一页返回的 next 原样传回, 取得第二页
+	var first, second state.IteratorDump
+	if err := client.Call(&first, "debug_accountRange", "latest", hexutil.Bytes(nil), 1, true, true); err != nil {
+		t.Fatalf("failed to get first page: %v", err)
+	}
+	if len(first.Accounts) != 1 || len(first.Next) == 0 {
+		t.Fatalf("first page mismatch: have %v, next %x", first.Accounts, first.Next)
+	}
+	if err := client.Call(&second, "debug_accountRange", "latest", first.Next, 1, true, true); err != nil {
+		t.Fatalf("failed to get second page: %v", err)
+	}
+	if len(second.Accounts) != 1 || len(second.Next) != 0 {
+		t.Fatalf("second page mismatch: have %v, next %x", second.Accounts, second.Next)
+	}
+	for addr := range first.Accounts {
+		if _, ok := second.Accounts[addr]; ok {
+			t.Errorf("account %s returned on both pages", addr)
+		}
+	}
+	for _, addr := range []common.Address{testAddr, other} {
+		if _, ok := first.Accounts[addr.Hex()]; !ok {
+			if _, ok := second.Accounts[addr.Hex()]; !ok {
+				t.Errorf("account %s missing from both pages", addr.Hex())
+			}
+		}
+	}
+}
+
+func TestDebugAPIModifiedAccounts(t *testing.T) {
+	proton, blocks := newTestProton(t, 1)
+	api := NewPrivateDebugAPI(proton)
+
+	// 在新的区块中修改一个账户
+	modified := common.Address{0xaa}
+	statedb, err := proton.blockchain.StateAt(blocks[1].Root())
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	statedb.AddBalance(modified, big.NewInt(1))
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := statedb.Database().TrieDB().Commit(root, true); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	block := types.NewBlock(&types.Header{
+		ParentHash: blocks[1].Hash(),
+		Number:     big.NewInt(2),
+		Root:       root,
+		Time:       blocks[1].Time() + 1,
+	}, nil, nil)
+	if _, err := proton.blockchain.InsertChain([]*types.Block{block}); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+
+	dirty, err := api.GetModifiedAccounts(2, nil)
+	if err != nil {
+		t.Fatalf("failed to get modified accounts: %v", err)
+	}
+	if len(dirty) != 1 || dirty[0] != modified {
+		t.Fatalf("modified accounts mismatch: have %x, want [%x]", dirty, modified)
+	}
+	end := uint64(1)
+	if dirty, err := api.GetModifiedAccounts(0, &end); err != nil || len(dirty) != 0 {
+		t.Fatalf("unexpected modified accounts: have %x, err %v", dirty, err)
+	}
+
+	if err := api.SetHead(hexutil.Uint64(1)); err != nil {
+		t.Fatalf("failed to set head: %v", err)
+	}
+	if head := proton.blockchain.CurrentBlock(); head.Hash() != blocks[1].Hash() {
+		t.Fatalf("head mismatch: have #%d, want #1", head.NumberU64())
+	}
+	if err := api.SetHead(hexutil.Uint64(5)); err == nil {
+		t.Fatalf("expected error when setting head beyond current head")
+	}
+}
+
+func TestDebugAPIGetBadBlocks(t *testing.T) {
+	proton, blocks := newTestProton(t, 1)
+	api := NewPrivateDebugAPI(proton)
+
+	if bad, err := api.GetBadBlocks(context.Background()); err != nil || len(bad) != 0 {
+		t.Fatalf("unexpected bad blocks: %v, %v", bad, err)
+	}
+	block := types.NewBlockWithHeader(&types.Header{ParentHash: blocks[0].Hash(), Number: big.NewInt(2)})
+	proton.blockchain.ReportBadBlock(block, errors.New("invalid root"), "peerA")
+
+	bad, err := api.GetBadBlocks(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get bad blocks: %v", err)
+	}
+	if len(bad) != 1 {
+		t.Fatalf("bad blocks count mismatch: have %d, want 1", len(bad))
+	}
+	if bad[0].Hash != block.Hash() || bad[0].Number != 2 || bad[0].Reason != "invalid root" || bad[0].Peer != "peerA" {
+		t.Errorf("bad block mismatch: %+v", bad[0])
+	}
+	if hash, _ := bad[0].Block["hash"].(common.Hash); hash != block.Hash() {
+		t.Errorf("marshalled block hash mismatch: have %v", bad[0].Block["hash"])
+	}
+}
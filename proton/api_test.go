@@ -0,0 +1,272 @@
+package proton
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/rawdb"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rlp"
+	"github.com/czh0526/perception/rpc"
+)
+
+var (
+	testAddr = common.BytesToAddress([]byte{1})
+	testKey  = common.BytesToHash([]byte{2})
+	testCode = []byte{0x60, 0x01}
+)
+
+func newTestProton(t *testing.T, n int) (*Proton, []*types.Block) {
+	return newTestProtonWithGenesis(t, &core.Genesis{Alloc: core.GenesisAlloc{
+		testAddr: {
+			Balance: big.NewInt(1000),
+			Nonce:   3,
+			Code:    testCode,
+			Storage: map[common.Hash]common.Hash{testKey: common.BytesToHash([]byte{0xff})},
+		},
+	}}, n)
+}
+
+func newTestProtonWithGenesis(t *testing.T, gspec *core.Genesis, n int) (*Proton, []*types.Block) {
+	db := rawdb.NewMemoryDatabase()
+	bc, blocks, err := core.GenerateBlockChain(db, gspec, n, nil)
+	if err != nil {
+		t.Fatalf("failed to generate chain: %v", err)
+	}
+	t.Cleanup(bc.Stop)
+
+	return &Proton{networkID: 7, chainDb: db, blockchain: bc, txPool: core.NewTxPool(bc)}, blocks
+}
+
+func newTestAPI(t *testing.T, n int) (*PublicBlockChainAPI, []*types.Block) {
+	proton, blocks := newTestProton(t, n)
+	return NewPublicBlockChainAPI(proton), blocks
+}
+
+func TestBlockChainAPIBlocks(t *testing.T) {
+	api, blocks := newTestAPI(t, 3)
+	ctx := context.Background()
+
+	if id := api.ChainId(); id != 7 {
+		t.Errorf("chain id mismatch: have %d, want 7", id)
+	}
+	if num := api.BlockNumber(); num != 3 {
+		t.Errorf("block number mismatch: have %d, want 3", num)
+	}
+
+	tests := []struct {
+		number rpc.BlockNumber
+		want   *types.Block
+	}{
+		{rpc.EarliestBlockNumber, blocks[0]},
+		{2, blocks[2]},
+		{rpc.LatestBlockNumber, blocks[3]},
+		{rpc.PendingBlockNumber, blocks[3]},
+		{4, nil},
+	}
+	for i, test := range tests {
+		fields := api.GetBlockByNumber(ctx, test.number, false)
+		if test.want == nil {
+			if fields != nil {
+				t.Errorf("test %d: expected nil block, have %v", i, fields)
+			}
+			continue
+		}
+		if hash := fields["hash"]; hash != test.want.Hash() {
+			t.Errorf("test %d: block hash mismatch: have %v, want %x", i, hash, test.want.Hash())
+		}
+		if _, ok := fields["transactions"]; !ok {
+			t.Errorf("test %d: transactions missing", i)
+		}
+		header := api.GetHeaderByNumber(ctx, test.number)
+		if hash := header["hash"]; hash != test.want.Hash() {
+			t.Errorf("test %d: header hash mismatch: have %v, want %x", i, hash, test.want.Hash())
+		}
+	}
+	if fields := api.GetBlockByHash(ctx, blocks[1].Hash(), true); fields["hash"] != blocks[1].Hash() {
+		t.Errorf("block by hash mismatch: have %v", fields["hash"])
+	}
+	if fields := api.GetBlockByHash(ctx, common.Hash{0xaa}, true); fields != nil {
+		t.Errorf("expected nil block for unknown hash, have %v", fields)
+	}
+}
+
+func TestBlockChainAPIState(t *testing.T) {
+	api, _ := newTestAPI(t, 2)
+	ctx := context.Background()
+
+	balance, err := api.GetBalance(ctx, testAddr, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to get balance: %v", err)
+	}
+	if balance.ToInt().Int64() != 1000 {
+		t.Errorf("balance mismatch: have %v, want 1000", balance)
+	}
+	nonce, err := api.GetNonce(ctx, testAddr, rpc.EarliestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to get nonce: %v", err)
+	}
+	if *nonce != 3 {
+		t.Errorf("nonce mismatch: have %d, want 3", *nonce)
+	}
+	code, err := api.GetCode(ctx, testAddr, 1)
+	if err != nil {
+		t.Fatalf("failed to get code: %v", err)
+	}
+	if !bytes.Equal(code, testCode) {
+		t.Errorf("code mismatch: have %x, want %x", code, testCode)
+	}
+	value, err := api.GetStorageAt(ctx, testAddr, testKey.Hex(), rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+	if common.BytesToHash(value) != common.BytesToHash([]byte{0xff}) {
+		t.Errorf("storage mismatch: have %x", value)
+	}
+
+	if _, err := api.GetBalance(ctx, testAddr, 10); err == nil {
+		t.Errorf("expected error for missing block")
+	}
+}
+
+func TestTransactionPoolAPI(t *testing.T) {
+	proton, blocks := newTestProton(t, 1)
+	api := NewPublicTransactionPoolAPI(proton)
+	ctx := context.Background()
+
+	tx := types.NewTransaction("transfer")
+	enc, _ := rlp.EncodeToBytes(tx)
+	hash, err := api.SendRawTransaction(ctx, hexutil.Bytes(enc))
+	if err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	if hash != tx.Hash() {
+		t.Fatalf("tx hash mismatch: have %x, want %x", hash, tx.Hash())
+	}
+	if _, err := api.SendRawTransaction(ctx, hexutil.Bytes(enc)); err != core.ErrAlreadyKnown {
+		t.Fatalf("error mismatch: have %v, want %v", err, core.ErrAlreadyKnown)
+	}
+	if _, err := api.SendRawTransaction(ctx, hexutil.Bytes{0xff}); err == nil {
+		t.Fatalf("expected error for invalid encoding")
+	}
+
+	// 尚未打包: 可以从交易池中查到, 但没有收据
+	if rpcTx := api.GetTransactionByHash(ctx, hash); rpcTx == nil || rpcTx.BlockHash != nil || rpcTx.Data != "transfer" {
+		t.Fatalf("pending transaction mismatch: have %+v", rpcTx)
+	}
+	if pending := api.PendingTransactions(); len(pending) != 1 || pending[0].Hash != hash {
+		t.Fatalf("pending transactions mismatch: have %v", pending)
+	}
+	if receipt, _ := api.GetTransactionReceipt(ctx, hash); receipt != nil {
+		t.Fatalf("receipt returned for pending transaction: %v", receipt)
+	}
+
+	// 打包之后可以查到所在的区块和收据
+	parent := blocks[len(blocks)-1]
+	block := types.NewBlock(&types.Header{
+		ParentHash: parent.Hash(),
+		Number:     big.NewInt(2),
+		Root:       parent.Root(),
+		Time:       parent.Time() + 1,
+	}, []*types.Transaction{tx}, nil)
+	if _, err := proton.blockchain.InsertChain([]*types.Block{block}); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	rpcTx := api.GetTransactionByHash(ctx, hash)
+	if rpcTx == nil || rpcTx.BlockHash == nil || *rpcTx.BlockHash != block.Hash() {
+		t.Fatalf("included transaction mismatch: have %+v", rpcTx)
+	}
+	if pending := api.PendingTransactions(); len(pending) != 0 {
+		t.Fatalf("pending transactions mismatch: have %v", pending)
+	}
+	receipt, err := api.GetTransactionReceipt(ctx, hash)
+	if err != nil || receipt == nil {
+		t.Fatalf("failed to get receipt: %v", err)
+	}
+	if receipt["blockHash"] != block.Hash() || receipt["blockNumber"] != hexutil.Uint64(2) {
+		t.Fatalf("receipt mismatch: have %v", receipt)
+	}
+	if fields := NewPublicBlockChainAPI(proton).GetBlockByNumber(ctx, 2, false); len(fields["transactions"].([]interface{})) != 1 {
+		t.Fatalf("block transactions mismatch: have %v", fields["transactions"])
+	}
+
+	nonce, err := api.GetTransactionCount(ctx, testAddr, rpc.PendingBlockNumber)
+	if err != nil || *nonce != 3 {
+		t.Fatalf("transaction count mismatch: have %v, err %v", nonce, err)
+	}
+}
+
+func TestProtocolManagerNodeInfo(t *testing.T) {
+	proton, blocks := newTestProton(t, 3)
+	pm, err := NewProtocolManager(proton.networkID, proton.chainDb, proton.blockchain)
+	if err != nil {
+		t.Fatalf("failed to create protocol manager: %v", err)
+	}
+
+	info := pm.NodeInfo()
+	if info.Network != 7 {
+		t.Errorf("network mismatch: have %d, want 7", info.Network)
+	}
+	if info.Genesis != blocks[0].Hash() {
+		t.Errorf("genesis mismatch: have %x, want %x", info.Genesis, blocks[0].Hash())
+	}
+	if info.Head != blocks[3].Hash() || info.Number != 3 {
+		t.Errorf("head mismatch: have #%d %x, want #3 %x", info.Number, info.Head, blocks[3].Hash())
+	}
+	if peerInfo := pm.PeerInfo("unknown", Protocol_V1); peerInfo != nil {
+		t.Errorf("unexpected peer info for unknown peer: %v", peerInfo)
+	}
+}
+
+func TestBlockChainAPIGetProof(t *testing.T) {
+	api, blocks := newTestAPI(t, 1)
+	ctx := context.Background()
+	root := blocks[1].Root()
+
+	missingKey := common.BytesToHash([]byte{3}).Hex()
+	result, err := api.GetProof(ctx, testAddr, []string{testKey.Hex(), missingKey}, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to get proof: %v", err)
+	}
+	if result.Balance.ToInt().Int64() != 1000 || result.Nonce != 3 {
+		t.Errorf("account mismatch: have balance %v nonce %d", result.Balance, result.Nonce)
+	}
+	if len(result.StorageProof) != 2 || result.StorageProof[0].Value.ToInt().Int64() != 0xff || result.StorageProof[1].Value.ToInt().Sign() != 0 {
+		t.Fatalf("storage proof mismatch: have %+v", result.StorageProof)
+	}
+	if err := VerifyProof(root, result); err != nil {
+		t.Fatalf("failed to verify proof: %v", err)
+	}
+
+	// 篡改返回值后校验失败
+	result.Balance = (*hexutil.Big)(big.NewInt(1001))
+	if err := VerifyProof(root, result); err == nil {
+		t.Errorf("expected error for tampered balance")
+	}
+	result.Balance = (*hexutil.Big)(big.NewInt(1000))
+	result.StorageProof[0].Value = (*hexutil.Big)(big.NewInt(1))
+	if err := VerifyProof(root, result); err == nil {
+		t.Errorf("expected error for tampered storage value")
+	}
+	if err := VerifyProof(common.Hash{0xaa}, result); err == nil {
+		t.Errorf("expected error for wrong state root")
+	}
+
+	// 不存在的账户, proof 证明其缺失
+	missing, err := api.GetProof(ctx, common.Address{0xaa}, []string{testKey.Hex()}, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to get proof for missing account: %v", err)
+	}
+	if err := VerifyProof(root, missing); err != nil {
+		t.Fatalf("failed to verify proof for missing account: %v", err)
+	}
+	missing.Nonce = 1
+	if err := VerifyProof(root, missing); err == nil {
+		t.Errorf("expected error for tampered missing account")
+	}
+}
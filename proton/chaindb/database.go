@@ -12,11 +12,22 @@ type KeyValueWriter interface {
 	Delete(key []byte) error
 }
 
+type Stater interface {
+	Stat(property string) (string, error)
+}
+
+type Compacter interface {
+	// 压缩 [start, limit) 范围内的数据, nil 表示不限制
+	Compact(start []byte, limit []byte) error
+}
+
 type KeyValueStore interface {
 	KeyValueReader
 	KeyValueWriter
 	Batcher
 	Iteratee
+	Stater
+	Compacter
 	io.Closer
 }
 
@@ -43,5 +54,7 @@ type Database interface {
 	Writer
 	Batcher
 	Iteratee
+	Stater
+	Compacter
 	io.Closer
 }
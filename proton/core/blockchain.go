@@ -3,15 +3,29 @@ package core
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/event"
 	"github.com/czh0526/perception/proton/chaindb"
 	"github.com/czh0526/perception/proton/core/rawdb"
 	"github.com/czh0526/perception/proton/core/state"
 	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rlp"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	maxFutureBlocks     = 256
+	maxTimeFutureBlocks = 30
+	maxUnknownParents   = 256
+
+	futureBlocksInterval = 5 * time.Second
 )
 
 type BlockChain struct {
@@ -23,12 +37,34 @@ type BlockChain struct {
 	chainmu      sync.RWMutex
 	stateCache   state.Database
 	currentBlock atomic.Value
+
+	futureBlocks   *lru.Cache // hash ==> 时间戳超前的区块
+	unknownParents *lru.Cache // parent hash ==> 等待 parent 到达的区块序列
+
+	chainFeed     event.Feed
+	chainSideFeed event.Feed
+	chainHeadFeed event.Feed
+	logsFeed      event.Feed
+	rmLogsFeed    event.Feed
+	scope         event.SubscriptionScope
+
+	now func() uint64 // 当前的 unix 时间, 用于判断未来区块, 测试中可以替换
+
+	quit chan struct{}
+	wg   sync.WaitGroup
 }
 
 func NewBlockChain(db chaindb.Database) (*BlockChain, error) {
+	futureBlocks, _ := lru.New(maxFutureBlocks)
+	unknownParents, _ := lru.New(maxUnknownParents)
+
 	bc := &BlockChain{
-		db:         db,
-		stateCache: state.NewDatabaseWithCache(db, 256),
+		db:             db,
+		stateCache:     state.NewDatabaseWithCache(db, 256),
+		futureBlocks:   futureBlocks,
+		unknownParents: unknownParents,
+		now:            func() uint64 { return uint64(time.Now().Unix()) },
+		quit:           make(chan struct{}),
 	}
 
 	// 初始化 header chain
@@ -50,9 +86,26 @@ func NewBlockChain(db chaindb.Database) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// 定时重试 future blocks
+	bc.wg.Add(1)
+	go bc.update()
+
 	return bc, nil
 }
 
+func (bc *BlockChain) Stop() {
+	select {
+	case <-bc.quit:
+		return
+	default:
+		close(bc.quit)
+	}
+	// 结束所有的事件订阅
+	bc.scope.Close()
+	bc.wg.Wait()
+	log.Println("Blockchain stopped.")
+}
+
 func (bc *BlockChain) State() (*state.StateDB, error) {
 	return bc.StateAt(bc.CurrentBlock().Root())
 }
@@ -61,6 +114,11 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache)
 }
 
+// 返回 blockchain 使用的 state 数据库
+func (bc *BlockChain) StateCache() state.Database {
+	return bc.stateCache
+}
+
 func (bc *BlockChain) loadLastState() error {
 	head := rawdb.ReadHeadBlockHash(bc.db)
 	if head == (common.Hash{}) {
@@ -80,6 +138,8 @@ func (bc *BlockChain) loadLastState() error {
 			return err
 		}
 		rawdb.WriteHeadBlockHash(bc.db, currentBlock.Hash())
+		// 区块头回退到同一位置, 从该区块之后重新同步
+		rawdb.WriteHeadHeaderHash(bc.db, currentBlock.Hash())
 	}
 
 	// 数据库一切正常，设置 blockchain
@@ -172,18 +232,20 @@ func (bc *BlockChain) SetHead(head uint64) error {
 			newHeadBlock := bc.GetBlock(header.Hash(), header.Number.Uint64())
 			if newHeadBlock == nil {
 				newHeadBlock = bc.genesisBlock
-			} else {
-				if _, err := state.New(newHeadBlock.Root(), bc.stateCache); err != nil {
-					newHeadBlock = bc.genesisBlock
-				}
 			}
+			// state 缺失的情况由 loadLastState 中的 repair 继续回溯
 			rawdb.WriteHeadBlockHash(db, newHeadBlock.Hash())
 			bc.currentBlock.Store(newHeadBlock)
 		}
 	}
 
-	// 删除 block body
+	// 删除 block body 以及其中交易的索引
 	delFn := func(db chaindb.KeyValueWriter, hash common.Hash, num uint64) {
+		if body := rawdb.ReadBody(bc.db, hash, num); body != nil {
+			for _, tx := range body.Transactions {
+				rawdb.DeleteTxLookupEntry(db, tx.Hash())
+			}
+		}
 		rawdb.DeleteBody(db, hash, num)
 	}
 
@@ -191,10 +253,60 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	return bc.loadLastState()
 }
 
+// 将全部的 canonical 区块以 RLP 格式写入 w
+func (bc *BlockChain) Export(w io.Writer) error {
+	return bc.ExportN(w, uint64(0), bc.CurrentBlock().NumberU64())
+}
+
+// 将 [first, last] 区间内的 canonical 区块以 RLP 格式写入 w
+func (bc *BlockChain) ExportN(w io.Writer, first uint64, last uint64) error {
+	bc.chainmu.RLock()
+	defer bc.chainmu.RUnlock()
+
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	log.Printf("Exporting batch of blocks, count = %d", last-first+1)
+
+	for nr := first; nr <= last; nr++ {
+		block := bc.GetBlockByNumber(nr)
+		if block == nil {
+			return fmt.Errorf("export failed on #%d: not found", nr)
+		}
+		if err := rlp.Encode(w, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (bc *BlockChain) GetHeaderByHash(hash common.Hash) *types.Header {
 	return bc.hc.GetHeaderByHash(hash)
 }
 
+func (bc *BlockChain) GetHeaderByNumber(number uint64) *types.Header {
+	return bc.hc.GetHeaderByNumber(number)
+}
+
+func (bc *BlockChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return bc.hc.GetHeader(hash, number)
+}
+
+func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
+	return len(rawdb.ReadBodyRLP(bc.db, hash, number)) > 0
+}
+
+func (bc *BlockChain) HasBlockAndState(hash common.Hash, number uint64) bool {
+	block := bc.GetBlock(hash, number)
+	if block == nil {
+		return false
+	}
+	_, err := state.New(block.Root(), bc.stateCache)
+	return err == nil
+}
+
+// InsertChain 将一段连续的区块插入链中, 返回实际写入的区块数.
+// parent 未知或者时间戳超前的区块只会被暂存, 不计入返回值, 出错时返回值为出错区块的索引.
 func (bc *BlockChain) InsertChain(chain []*types.Block) (int, error) {
 	if len(chain) == 0 {
 		return 0, nil
@@ -209,7 +321,7 @@ func (bc *BlockChain) InsertChain(chain []*types.Block) (int, error) {
 		block = chain[i]
 		prev = chain[i-1]
 		if block.NumberU64() != prev.NumberU64()+1 || block.ParentHash() != prev.Hash() {
-			log.Fatalf("Non contiguous block insert, number = %d, hash = %0x, parent = %0x, prevnumber = %v, prevhash = %0x",
+			log.Printf("Non contiguous block insert, number = %d, hash = %0x, parent = %0x, prevnumber = %v, prevhash = %0x",
 				block.Number(), block.Hash(), block.ParentHash(), prev.Number(), prev.Hash())
 
 			return 0, fmt.Errorf("Non contiguous block insert, number = %d, hash = %0x, parent = %0x, prevnumber = %v, prevhash = %0x",
@@ -217,12 +329,46 @@ func (bc *BlockChain) InsertChain(chain []*types.Block) (int, error) {
 		}
 	}
 
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
 	return bc.insertChain(chain, true)
 }
 
 func (bc *BlockChain) insertChain(chain []*types.Block, verifySeals bool) (int, error) {
+	var released [][]*types.Block
+	defer func() {
+		// parent 已经到达的区块序列，接着插入
+		for _, children := range released {
+			if _, err := bc.insertChain(children, verifySeals); err != nil {
+				log.Printf("Failed to insert queued children, parent = %0x, err = %v", children[0].ParentHash(), err)
+			}
+		}
+	}()
+
 	for i, blk := range chain {
 		block := blk
+		switch err := bc.verifyHeader(block.Header()); err {
+		case nil:
+
+		case ErrKnownBlock:
+			continue
+
+		case ErrUnknownAncestor:
+			// parent 未知，剩余的区块以 parent hash 为键暂存
+			bc.addUnknownParent(chain[i:])
+			return i, nil
+
+		case ErrFutureBlock:
+			// 时间戳超前，剩余的区块暂存，等待定时重试
+			for _, b := range chain[i:] {
+				bc.addFutureBlock(b)
+			}
+			return i, nil
+
+		default:
+			return i, err
+		}
+
 		statedb, err := state.New(block.Root(), bc.stateCache)
 		if err != nil {
 			return i, err
@@ -230,10 +376,130 @@ func (bc *BlockChain) insertChain(chain []*types.Block, verifySeals bool) (int,
 		if err := bc.writeBlockWithState(block, statedb); err != nil {
 			return i, err
 		}
+		if children, ok := bc.unknownParents.Get(block.Hash()); ok {
+			bc.unknownParents.Remove(block.Hash())
+			released = append(released, children.([]*types.Block))
+		}
 	}
 	return len(chain), nil
 }
 
+// 订阅区块写入 canonical 链的事件
+func (bc *BlockChain) SubscribeChainEvent(ch chan<- ChainEvent) event.Subscription {
+	return bc.scope.Track(bc.chainFeed.Subscribe(ch))
+}
+
+// 订阅链头变化的事件
+func (bc *BlockChain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Subscription {
+	return bc.scope.Track(bc.chainHeadFeed.Subscribe(ch))
+}
+
+// 订阅 canonical 区块被替换的事件
+func (bc *BlockChain) SubscribeChainSideEvent(ch chan<- ChainSideEvent) event.Subscription {
+	return bc.scope.Track(bc.chainSideFeed.Subscribe(ch))
+}
+
+// 订阅新产生的日志. 目前交易不会被执行, 不会产生日志, 订阅者永远收不到事件.
+func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
+}
+
+// 订阅因链重组被移除的日志. 与 SubscribeLogsEvent 相同, 目前没有日志, 订阅者永远收不到事件.
+func (bc *BlockChain) SubscribeRemovedLogsEvent(ch chan<- RemovedLogsEvent) event.Subscription {
+	return bc.scope.Track(bc.rmLogsFeed.Subscribe(ch))
+}
+
+// 检查区块头能否被插入链中
+func (bc *BlockChain) verifyHeader(header *types.Header) error {
+	number := header.Number.Uint64()
+	if bc.HasBlockAndState(header.Hash(), number) {
+		return ErrKnownBlock
+	}
+
+	now := bc.now()
+	if header.Time > now+maxTimeFutureBlocks {
+		return ErrTooFarInFuture
+	}
+
+	parent := bc.GetHeader(header.ParentHash, number-1)
+	if number == 0 || parent == nil {
+		return ErrUnknownAncestor
+	}
+	if header.Time <= parent.Time {
+		return ErrOlderBlockTime
+	}
+
+	if header.Time > now {
+		return ErrFutureBlock
+	}
+	return nil
+}
+
+// 记录校验失败的区块, peer 为提供该区块的节点
+func (bc *BlockChain) ReportBadBlock(block *types.Block, reason error, peer string) {
+	rawdb.WriteBadBlock(bc.db, block, reason.Error(), peer, uint64(time.Now().Unix()))
+	log.Printf("Bad block, number = %d, hash = %0x, peer = %s, reason = %v", block.NumberU64(), block.Hash(), peer, reason)
+}
+
+func (bc *BlockChain) BadBlocks() []*rawdb.BadBlock {
+	return rawdb.ReadAllBadBlocks(bc.db)
+}
+
+func (bc *BlockChain) addFutureBlock(block *types.Block) {
+	bc.futureBlocks.Add(block.Hash(), block)
+}
+
+func (bc *BlockChain) addUnknownParent(blocks []*types.Block) {
+	parentHash := blocks[0].ParentHash()
+	if queued, ok := bc.unknownParents.Peek(parentHash); ok {
+		// 同一个 parent 已经有等待的区块，保留更长的序列
+		if len(queued.([]*types.Block)) >= len(blocks) {
+			return
+		}
+	}
+	bc.unknownParents.Add(parentHash, blocks)
+	log.Printf("Queued blocks with unknown parent, number = %d, parent = %0x, count = %d",
+		blocks[0].NumberU64(), parentHash, len(blocks))
+}
+
+func (bc *BlockChain) procFutureBlocks() {
+	blocks := make([]*types.Block, 0, bc.futureBlocks.Len())
+	for _, hash := range bc.futureBlocks.Keys() {
+		if block, exist := bc.futureBlocks.Peek(hash); exist {
+			blocks = append(blocks, block.(*types.Block))
+		}
+	}
+	if len(blocks) == 0 {
+		return
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].NumberU64() < blocks[j].NumberU64()
+	})
+	// 逐个插入，允许 future blocks 之间不连续
+	for i := range blocks {
+		bc.futureBlocks.Remove(blocks[i].Hash())
+		if _, err := bc.InsertChain(blocks[i : i+1]); err != nil {
+			log.Printf("Failed to insert future block, number = %d, err = %v", blocks[i].NumberU64(), err)
+		}
+	}
+}
+
+func (bc *BlockChain) update() {
+	defer bc.wg.Done()
+
+	futureTimer := time.NewTicker(futureBlocksInterval)
+	defer futureTimer.Stop()
+	for {
+		select {
+		case <-futureTimer.C:
+			bc.procFutureBlocks()
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
 func (bc *BlockChain) writeBlockWithState(block *types.Block, statedb *state.StateDB) error {
 	// 写入 Block
 	rawdb.WriteBlock(bc.db, block)
@@ -251,15 +517,25 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, statedb *state.Sta
 	log.Printf("Update Global-State[Trie] into database.")
 
 	bc.insert(block)
+	bc.futureBlocks.Remove(block.Hash())
 	log.Printf("Update BlockChain's variables into database.")
 	return nil
 }
 
 func (bc *BlockChain) insert(block *types.Block) {
 	//log.Printf("block %d's canonical hash = %0x, block hash = %0x", block.NumberU64(), rawdb.ReadCanonicalHash(bc.db, block.NumberU64()), block.Hash())
-	updateHeads := rawdb.ReadCanonicalHash(bc.db, block.NumberU64()) != block.Hash()
+	oldHash := rawdb.ReadCanonicalHash(bc.db, block.NumberU64())
+	updateHeads := oldHash != block.Hash()
+
+	// 原来的 canonical 区块被替换, 通知订阅者该区块已经成为分叉
+	if updateHeads && oldHash != (common.Hash{}) {
+		if old := bc.GetBlock(oldHash, block.NumberU64()); old != nil {
+			bc.chainSideFeed.Send(ChainSideEvent{Block: old})
+		}
+	}
 
 	rawdb.WriteCanonicalHash(bc.db, block.Hash(), block.NumberU64())
+	rawdb.WriteTxLookupEntries(bc.db, block)
 	//log.Printf("write block %d with canonical Hash.", block.NumberU64())
 	rawdb.WriteHeadBlockHash(bc.db, block.Hash())
 	//log.Printf("write head block = %d.", block.NumberU64())
@@ -269,20 +545,35 @@ func (bc *BlockChain) insert(block *types.Block) {
 		bc.hc.SetCurrentHeader(block.Header())
 		//log.Printf("write current header = %d.", block.Header().Number)
 	}
+
+	// 区块中的交易目前不会被执行, 因此没有日志产生
+	bc.chainFeed.Send(ChainEvent{Block: block, Hash: block.Hash()})
+	bc.chainHeadFeed.Send(ChainHeadEvent{Block: block})
 	//currentBlockNumber := bc.CurrentBlock().NumberU64()
 	//log.Printf("chain current block = %d, chain current header = %d", currentBlockNumber, bc.CurrentHeader().Number)
 }
 
+// 从 head 开始向前回溯, 直到找到 state 完整的区块
 func (bc *BlockChain) repair(head **types.Block) error {
+	from := *head
 	for {
 		if _, err := state.New((*head).Root(), bc.stateCache); err == nil {
-			log.Printf("Rewound blockchain to past state, num = %v, hash = %v", (*head).Number(), (*head).Hash())
+			if discarded := from.NumberU64() - (*head).NumberU64(); discarded > 0 {
+				log.Printf("Rewound blockchain to past state, discarded = %d (#%d -> #%d), num = %v, hash = 0x%0x",
+					discarded, (*head).NumberU64()+1, from.NumberU64(), (*head).Number(), (*head).Hash())
+			}
 			return nil
 		}
+		if (*head).NumberU64() == 0 {
+			return fmt.Errorf("missing state of genesis block [%x]", (*head).Hash())
+		}
 
 		block := bc.GetBlock((*head).ParentHash(), (*head).NumberU64()-1)
 		if block == nil {
 			return fmt.Errorf("missing block %d [%x]", (*head).NumberU64()-1, (*head).ParentHash())
 		}
+		log.Printf("Discard block without state, number = %d, hash = 0x%0x, root = 0x%0x",
+			(*head).NumberU64(), (*head).Hash(), (*head).Root())
+		*head = block
 	}
 }
@@ -0,0 +1,314 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/proton/core/rawdb"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rlp"
+)
+
+func newTestBlockChain(t *testing.T) (*BlockChain, *types.Block) {
+	db := rawdb.NewMemoryDatabase()
+	gspec := &Genesis{Alloc: GenesisAlloc{
+		common.BytesToAddress([]byte{1}): {Balance: big.NewInt(1000)},
+	}}
+	genesis, err := gspec.Commit(db)
+	if err != nil {
+		t.Fatalf("failed to commit genesis: %v", err)
+	}
+	bc, err := NewBlockChain(db)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	return bc, genesis
+}
+
+// 生成时间戳已经过去的区块链
+func makePastChain(parent *types.Block, n int) []*types.Block {
+	blocks := make([]*types.Block, n)
+	start := uint64(time.Now().Unix()) - uint64(n)*10
+	for i := 0; i < n; i++ {
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), big.NewInt(1)),
+			Root:       parent.Root(),
+			Time:       start + uint64(i)*10,
+		}
+		blocks[i] = types.NewBlock(header, nil, nil)
+		parent = blocks[i]
+	}
+	return blocks
+}
+
+func TestInsertUnknownParentBlocks(t *testing.T) {
+	bc, genesis := newTestBlockChain(t)
+	defer bc.Stop()
+
+	blocks := makePastChain(genesis, 6)
+
+	// 乱序到达: 先插入后半段
+	if n, err := bc.InsertChain(blocks[3:]); err != nil || n != 0 {
+		t.Fatalf("failed to queue blocks: inserted %d, err %v", n, err)
+	}
+	if num := bc.CurrentBlock().NumberU64(); num != 0 {
+		t.Fatalf("head moved before parent arrived: have %d, want 0", num)
+	}
+	if n, err := bc.InsertChain(blocks[:3]); err != nil || n != 3 {
+		t.Fatalf("failed to insert blocks: inserted %d, err %v", n, err)
+	}
+	if head := bc.CurrentBlock(); head.Hash() != blocks[5].Hash() {
+		t.Fatalf("head mismatch: have %d, want %d", head.NumberU64(), blocks[5].NumberU64())
+	}
+}
+
+func TestInsertFutureBlocks(t *testing.T) {
+	bc, genesis := newTestBlockChain(t)
+	defer bc.Stop()
+
+	// 使用可控的时钟, 不依赖真实时间的流逝
+	now := uint64(time.Now().Unix())
+	clock := now
+	bc.chainmu.Lock()
+	bc.now = func() uint64 { return atomic.LoadUint64(&clock) }
+	bc.chainmu.Unlock()
+
+	blocks := makePastChain(genesis, 2)
+	future := types.NewBlock(&types.Header{
+		ParentHash: blocks[1].Hash(),
+		Number:     big.NewInt(3),
+		Root:       genesis.Root(),
+		Time:       now + 2,
+	}, nil, nil)
+
+	if n, err := bc.InsertChain(append(blocks, future)); err != nil || n != 2 {
+		t.Fatalf("failed to insert chain: inserted %d, err %v", n, err)
+	}
+	if head := bc.CurrentBlock(); head.Hash() != blocks[1].Hash() {
+		t.Fatalf("head mismatch: have %d, want %d", head.NumberU64(), blocks[1].NumberU64())
+	}
+	if !bc.futureBlocks.Contains(future.Hash()) {
+		t.Fatalf("future block not queued")
+	}
+
+	// 未到时间的区块保持暂存
+	bc.procFutureBlocks()
+	if head := bc.CurrentBlock(); head.Hash() != blocks[1].Hash() {
+		t.Fatalf("future block inserted early: head = %d", head.NumberU64())
+	}
+	atomic.StoreUint64(&clock, future.Time())
+	bc.procFutureBlocks()
+	if head := bc.CurrentBlock(); head.Hash() != future.Hash() {
+		t.Fatalf("future block not inserted: head = %d", head.NumberU64())
+	}
+
+	tooFar := types.NewBlock(&types.Header{
+		ParentHash: future.Hash(),
+		Number:     big.NewInt(4),
+		Root:       genesis.Root(),
+		Time:       future.Time() + 2*maxTimeFutureBlocks,
+	}, nil, nil)
+	if _, err := bc.InsertChain([]*types.Block{tooFar}); err != ErrTooFarInFuture {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrTooFarInFuture)
+	}
+}
+
+func TestExportBlocks(t *testing.T) {
+	bc, genesis := newTestBlockChain(t)
+	defer bc.Stop()
+
+	blocks := makePastChain(genesis, 4)
+	if _, err := bc.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := bc.ExportN(&buf, 1, 3); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	stream := rlp.NewStream(&buf, 0)
+	for i := 0; ; i++ {
+		var block types.Block
+		if err := stream.Decode(&block); err == io.EOF {
+			if i != 3 {
+				t.Fatalf("exported block count mismatch: have %d, want 3", i)
+			}
+			break
+		} else if err != nil {
+			t.Fatalf("failed to decode block %d: %v", i, err)
+		}
+		if block.Hash() != blocks[i].Hash() {
+			t.Fatalf("block %d mismatch: have %x, want %x", i, block.Hash(), blocks[i].Hash())
+		}
+	}
+
+	if err := bc.ExportN(&buf, 3, 1); err == nil {
+		t.Fatalf("expected error for reversed range")
+	}
+}
+
+func TestRepairMissingState(t *testing.T) {
+	bc, genesis := newTestBlockChain(t)
+
+	blocks := makePastChain(genesis, 3)
+	if _, err := bc.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// 模拟异常退出: 区块已经写入, 但 state 没有写入
+	parent := blocks[2]
+	for i := 0; i < 2; i++ {
+		block := types.NewBlock(&types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), big.NewInt(1)),
+			Root:       common.BytesToHash([]byte{0xde, 0xad, byte(i)}),
+			Time:       parent.Time() + 1,
+		}, nil, nil)
+		rawdb.WriteBlock(bc.db, block)
+		rawdb.WriteCanonicalHash(bc.db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(bc.db, block.Hash())
+		rawdb.WriteHeadHeaderHash(bc.db, block.Hash())
+		parent = block
+	}
+	bc.Stop()
+
+	bc, err := NewBlockChain(bc.db)
+	if err != nil {
+		t.Fatalf("failed to reopen blockchain: %v", err)
+	}
+	defer bc.Stop()
+	if head := bc.CurrentBlock(); head.Hash() != blocks[2].Hash() {
+		t.Fatalf("head block mismatch: have %d, want %d", head.NumberU64(), blocks[2].NumberU64())
+	}
+	if head := bc.CurrentHeader(); head.Hash() != blocks[2].Hash() {
+		t.Fatalf("head header mismatch: have %d, want %d", head.Number, blocks[2].NumberU64())
+	}
+}
+
+func TestSetHead(t *testing.T) {
+	bc, genesis := newTestBlockChain(t)
+	defer bc.Stop()
+
+	blocks := makePastChain(genesis, 5)
+	if _, err := bc.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if err := bc.SetHead(2); err != nil {
+		t.Fatalf("failed to set head: %v", err)
+	}
+	if head := bc.CurrentBlock(); head.Hash() != blocks[1].Hash() {
+		t.Fatalf("head block mismatch: have %d, want 2", head.NumberU64())
+	}
+	if head := bc.CurrentHeader(); head.Hash() != blocks[1].Hash() {
+		t.Fatalf("head header mismatch: have %d, want 2", head.Number)
+	}
+	for _, block := range blocks[2:] {
+		if bc.GetBlockByNumber(block.NumberU64()) != nil {
+			t.Fatalf("canonical block %d not deleted", block.NumberU64())
+		}
+		if bc.GetHeaderByHash(block.Hash()) != nil || bc.HasBlock(block.Hash(), block.NumberU64()) {
+			t.Fatalf("block %d not deleted", block.NumberU64())
+		}
+	}
+}
+
+func TestChainEvents(t *testing.T) {
+	bc, genesis := newTestBlockChain(t)
+	defer bc.Stop()
+
+	heads := make(chan ChainHeadEvent, 10)
+	sides := make(chan ChainSideEvent, 10)
+	headSub := bc.SubscribeChainHeadEvent(heads)
+	sideSub := bc.SubscribeChainSideEvent(sides)
+	defer headSub.Unsubscribe()
+	defer sideSub.Unsubscribe()
+
+	blocks := makePastChain(genesis, 2)
+	if _, err := bc.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for _, block := range blocks {
+		if ev := <-heads; ev.Block.Hash() != block.Hash() {
+			t.Fatalf("head event mismatch: have %d, want %d", ev.Block.NumberU64(), block.NumberU64())
+		}
+	}
+
+	// 同一高度上的另一个区块替换了原来的 canonical 区块
+	fork := types.NewBlock(&types.Header{
+		ParentHash: blocks[0].Hash(),
+		Number:     big.NewInt(2),
+		Root:       genesis.Root(),
+		Time:       blocks[1].Time() + 1,
+	}, nil, nil)
+	if _, err := bc.InsertChain([]*types.Block{fork}); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	if ev := <-heads; ev.Block.Hash() != fork.Hash() {
+		t.Fatalf("head event mismatch: have %x, want %x", ev.Block.Hash(), fork.Hash())
+	}
+	if ev := <-sides; ev.Block.Hash() != blocks[1].Hash() {
+		t.Fatalf("side event mismatch: have %x, want %x", ev.Block.Hash(), blocks[1].Hash())
+	}
+
+	// Stop 结束全部的订阅
+	bc.Stop()
+	if _, ok := <-headSub.Err(); ok {
+		t.Fatalf("subscription not closed after stop")
+	}
+}
+
+func TestGenerateBlockChain(t *testing.T) {
+	gspec := &Genesis{Alloc: GenesisAlloc{
+		common.BytesToAddress([]byte{1}): {Balance: big.NewInt(1000)},
+	}}
+	tx := types.NewTransaction("generate")
+	bc, blocks, err := GenerateBlockChain(rawdb.NewMemoryDatabase(), gspec, 3, func(i int, b *BlockGen) {
+		if i == 1 {
+			b.AddTx(tx)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to generate chain: %v", err)
+	}
+	defer bc.Stop()
+
+	if len(blocks) != 4 || blocks[0].NumberU64() != 0 {
+		t.Fatalf("blocks mismatch: have %d blocks", len(blocks))
+	}
+	if head := bc.CurrentBlock(); head.Hash() != blocks[3].Hash() {
+		t.Errorf("head mismatch: have %d, want 3", head.NumberU64())
+	}
+	if txs := bc.GetBlockByNumber(2).Transactions(); len(txs) != 1 || txs[0].Hash() != tx.Hash() {
+		t.Errorf("transactions mismatch: have %v", txs)
+	}
+	if now := uint64(time.Now().Unix()); blocks[3].Time() >= now {
+		t.Errorf("head block in the future: have %d, now %d", blocks[3].Time(), now)
+	}
+}
+
+func TestInsertOlderBlockTime(t *testing.T) {
+	bc, genesis := newTestBlockChain(t)
+	defer bc.Stop()
+
+	blocks := makePastChain(genesis, 2)
+	header := blocks[1].Header()
+	header.Time = blocks[0].Time()
+	invalid := types.NewBlock(header, nil, nil)
+	if n, err := bc.InsertChain([]*types.Block{blocks[0], invalid}); err != ErrOlderBlockTime || n != 1 {
+		t.Fatalf("insert mismatch: inserted %d, err %v, want %v", n, err, ErrOlderBlockTime)
+	}
+	if !IsConsensusError(ErrOlderBlockTime) {
+		t.Errorf("%v not classified as consensus error", ErrOlderBlockTime)
+	}
+	for _, err := range []error{ErrFutureBlock, ErrTooFarInFuture, errors.New("missing trie node")} {
+		if IsConsensusError(err) {
+			t.Errorf("%v classified as consensus error", err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"math/big"
 	"time"
 
@@ -16,6 +17,17 @@ type BlockGen struct {
 	chain   []*types.Block
 	header  *types.Header
 	statedb *state.StateDB
+	txs     []*types.Transaction
+}
+
+// AddTx 将交易打包进正在生成的区块
+func (b *BlockGen) AddTx(tx *types.Transaction) {
+	b.txs = append(b.txs, tx)
+}
+
+// OffsetTime 调整区块的时间戳, 后续区块在此基础上递增
+func (b *BlockGen) OffsetTime(seconds int64) {
+	b.header.Time = uint64(int64(b.header.Time) + seconds)
 }
 
 func GenerateChain(parent *types.Block, db chaindb.Database, n int, gen func(int, *BlockGen)) []*types.Block {
@@ -30,7 +42,7 @@ func GenerateChain(parent *types.Block, db chaindb.Database, n int, gen func(int
 		}
 
 		b.header.Root = statedb.IntermediateRoot(true)
-		block := types.NewBlock(b.header, []*types.Transaction{}, []*types.Header{})
+		block := types.NewBlock(b.header, b.txs, []*types.Header{})
 		return block
 	}
 
@@ -46,6 +58,36 @@ func GenerateChain(parent *types.Block, db chaindb.Database, n int, gen func(int
 	return blocks
 }
 
+// GenerateBlockChain 在 db 中提交 genesis, 生成 n 个区块并插入新建的区块链.
+// 返回的区块以 genesis 开头, 时间戳早于当前时间, 不会被当作未来区块.
+// 调用者负责停止返回的区块链.
+func GenerateBlockChain(db chaindb.Database, gspec *Genesis, n int, gen func(int, *BlockGen)) (*BlockChain, []*types.Block, error) {
+	genesis, err := gspec.Commit(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	bc, err := NewBlockChain(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks := GenerateChain(genesis, db, n, func(i int, b *BlockGen) {
+		if i == 0 {
+			b.OffsetTime(-10 * int64(n))
+		}
+		if gen != nil {
+			gen(i, b)
+		}
+	})
+	if n, err := bc.InsertChain(blocks); err != nil || n != len(blocks) {
+		bc.Stop()
+		if err == nil {
+			err = fmt.Errorf("only %d of %d blocks inserted", n, len(blocks))
+		}
+		return nil, nil, err
+	}
+	return bc, append([]*types.Block{genesis}, blocks...), nil
+}
+
 func makeHeader(parent *types.Block, state *state.StateDB) *types.Header {
 	var timestamp uint64
 	if parent.Time() == 0 {
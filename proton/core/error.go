@@ -0,0 +1,26 @@
+package core
+
+import "errors"
+
+var (
+	// 区块已经存在于本地数据库中
+	ErrKnownBlock = errors.New("block already known")
+
+	// 区块的 parent 不在本地数据库中
+	ErrUnknownAncestor = errors.New("unknown ancestor")
+
+	// 区块的时间戳超前于本地时间, 但仍在容忍的窗口之内
+	ErrFutureBlock = errors.New("block in the future")
+
+	// 区块的时间戳超出了容忍的窗口
+	ErrTooFarInFuture = errors.New("block too far in the future")
+
+	// 区块的时间戳不晚于 parent
+	ErrOlderBlockTime = errors.New("timestamp older than parent")
+)
+
+// IsConsensusError 判断 InsertChain 返回的错误是否说明区块本身违反了共识规则.
+// 时间戳超前可能只是两端的时钟不一致, 读写 state 失败是本地的问题, 都不属于共识错误.
+func IsConsensusError(err error) bool {
+	return err == ErrOlderBlockTime
+}
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/proton/core/types"
+)
+
+// 新交易进入交易池时发送
+type NewTxsEvent struct{ Txs []*types.Transaction }
+
+// 日志因链重组被移出 canonical 链时发送
+type RemovedLogsEvent struct{ Logs []*types.Log }
+
+// 区块被写入 canonical 链时发送
+type ChainEvent struct {
+	Block *types.Block
+	Hash  common.Hash
+	Logs  []*types.Log
+}
+
+// canonical 链上某个高度的区块被另一个区块替换时, 为被替换的区块发送
+type ChainSideEvent struct {
+	Block *types.Block
+}
+
+// 链头发生变化时发送
+type ChainHeadEvent struct{ Block *types.Block }
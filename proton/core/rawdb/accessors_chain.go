@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"log"
+	"sort"
 
 	"github.com/czh0526/perception/common"
 	"github.com/czh0526/perception/proton/chaindb"
@@ -217,3 +218,75 @@ func DeleteBody(db chaindb.KeyValueWriter, hash common.Hash, number uint64) {
 		log.Fatalf("Failed to delete block body, err = %v", err)
 	}
 }
+
+const badBlockToKeep = 10
+
+// 校验失败的区块，以及失败的原因和提供该区块的节点
+type BadBlock struct {
+	Header *types.Header
+	Body   *types.Body
+	Reason string
+	Peer   string
+	Time   uint64
+}
+
+func (b *BadBlock) Block() *types.Block {
+	return types.NewBlockWithHeader(b.Header).WithBody(b.Body.Transactions)
+}
+
+type badBlockList []*BadBlock
+
+func (s badBlockList) Len() int { return len(s) }
+func (s badBlockList) Less(i, j int) bool {
+	return s[i].Header.Number.Uint64() < s[j].Header.Number.Uint64()
+}
+func (s badBlockList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func ReadAllBadBlocks(db chaindb.Reader) []*BadBlock {
+	data, _ := db.Get(badBlockKey)
+	if len(data) == 0 {
+		return nil
+	}
+	var badBlocks badBlockList
+	if err := rlp.DecodeBytes(data, &badBlocks); err != nil {
+		log.Printf("Invalid bad blocks RLP, err = %v", err)
+		return nil
+	}
+	return badBlocks
+}
+
+// 记录最新的 badBlockToKeep 个 bad block, 按区块编号从高到低排列
+func WriteBadBlock(db chaindb.KeyValueStore, block *types.Block, reason string, peer string, time uint64) {
+	var badBlocks badBlockList
+	for _, b := range ReadAllBadBlocks(db) {
+		if b.Header.Hash() == block.Hash() {
+			return
+		}
+		badBlocks = append(badBlocks, b)
+	}
+	badBlocks = append(badBlocks, &BadBlock{
+		Header: block.Header(),
+		Body:   block.Body(),
+		Reason: reason,
+		Peer:   peer,
+		Time:   time,
+	})
+	sort.Sort(sort.Reverse(badBlocks))
+	if len(badBlocks) > badBlockToKeep {
+		badBlocks = badBlocks[:badBlockToKeep]
+	}
+
+	data, err := rlp.EncodeToBytes(badBlocks)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to encode bad blocks, err = %v", err))
+	}
+	if err := db.Put(badBlockKey, data); err != nil {
+		panic(fmt.Sprintf("Failed to write bad blocks, err = %v", err))
+	}
+}
+
+func DeleteBadBlocks(db chaindb.KeyValueWriter) {
+	if err := db.Delete(badBlockKey); err != nil {
+		log.Fatalf("Failed to delete bad blocks, err = %v", err)
+	}
+}
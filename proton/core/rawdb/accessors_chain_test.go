@@ -0,0 +1,47 @@
+package rawdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/czh0526/perception/proton/core/types"
+)
+
+func TestBadBlockStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if blocks := ReadAllBadBlocks(db); len(blocks) != 0 {
+		t.Fatalf("non existent bad blocks returned: %v", blocks)
+	}
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	WriteBadBlock(db, block, "bad root", "peerA", 100)
+	// 重复写入同一个区块被忽略
+	WriteBadBlock(db, block, "bad root", "peerB", 200)
+
+	blocks := ReadAllBadBlocks(db)
+	if len(blocks) != 1 {
+		t.Fatalf("bad blocks count mismatch: have %d, want 1", len(blocks))
+	}
+	if blocks[0].Block().Hash() != block.Hash() || blocks[0].Reason != "bad root" || blocks[0].Peer != "peerA" {
+		t.Fatalf("bad block mismatch: have %v", blocks[0])
+	}
+
+	// 超出上限后只保留编号最高的区块
+	for i := 2; i <= badBlockToKeep+5; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i))})
+		WriteBadBlock(db, block, "bad root", "peerA", uint64(i))
+	}
+	blocks = ReadAllBadBlocks(db)
+	if len(blocks) != badBlockToKeep {
+		t.Fatalf("bad blocks count mismatch: have %d, want %d", len(blocks), badBlockToKeep)
+	}
+	if num := blocks[0].Header.Number.Uint64(); num != badBlockToKeep+5 {
+		t.Fatalf("newest bad block mismatch: have %d, want %d", num, badBlockToKeep+5)
+	}
+
+	DeleteBadBlocks(db)
+	if blocks := ReadAllBadBlocks(db); len(blocks) != 0 {
+		t.Fatalf("bad blocks not deleted: %v", blocks)
+	}
+}
@@ -0,0 +1,58 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/proton/chaindb"
+	"github.com/czh0526/perception/proton/core/types"
+)
+
+// TxLookupEntry:  tx hash ==> block number
+func ReadTxLookupEntry(db chaindb.Reader, hash common.Hash) *uint64 {
+	data, _ := db.Get(txLookupKey(hash))
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// 为区块中的每一笔交易写入 tx hash ==> block number 的索引
+func WriteTxLookupEntries(db chaindb.KeyValueWriter, block *types.Block) {
+	number := encodeBlockNumber(block.NumberU64())
+	for _, tx := range block.Transactions() {
+		if err := db.Put(txLookupKey(tx.Hash()), number); err != nil {
+			panic(fmt.Sprintf("Failed to store transaction lookup entry, err = %v", err))
+		}
+	}
+}
+
+func DeleteTxLookupEntry(db chaindb.KeyValueWriter, hash common.Hash) {
+	if err := db.Delete(txLookupKey(hash)); err != nil {
+		panic(fmt.Sprintf("Failed to delete transaction lookup entry, err = %v", err))
+	}
+}
+
+// 通过索引找到交易所在的 canonical 区块, 返回交易以及它在区块中的位置
+func ReadTransaction(db chaindb.Reader, hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64) {
+	number := ReadTxLookupEntry(db, hash)
+	if number == nil {
+		return nil, common.Hash{}, 0, 0
+	}
+	blockHash := ReadCanonicalHash(db, *number)
+	if blockHash == (common.Hash{}) {
+		return nil, common.Hash{}, 0, 0
+	}
+	body := ReadBody(db, blockHash, *number)
+	if body == nil {
+		return nil, common.Hash{}, 0, 0
+	}
+	for index, tx := range body.Transactions {
+		if tx.Hash() == hash {
+			return tx, blockHash, *number, uint64(index)
+		}
+	}
+	return nil, common.Hash{}, 0, 0
+}
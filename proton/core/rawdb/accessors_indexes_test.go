@@ -0,0 +1,45 @@
+package rawdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/czh0526/perception/proton/core/types"
+)
+
+func TestLookupStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	txs := []*types.Transaction{types.NewTransaction("a"), types.NewTransaction("b")}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(3)}, txs, nil)
+
+	for _, tx := range txs {
+		if txn, _, _, _ := ReadTransaction(db, tx.Hash()); txn != nil {
+			t.Fatalf("tx #%x: non existent transaction returned: %v", tx.Hash(), txn)
+		}
+	}
+	WriteBlock(db, block)
+	WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+	WriteTxLookupEntries(db, block)
+
+	for i, tx := range txs {
+		txn, hash, number, index := ReadTransaction(db, tx.Hash())
+		if txn == nil {
+			t.Fatalf("tx #%x: transaction not found", tx.Hash())
+		}
+		if hash != block.Hash() || number != block.NumberU64() || index != uint64(i) {
+			t.Fatalf("tx #%x: positional metadata mismatch: have %x/%d/%d, want %x/%d/%d",
+				tx.Hash(), hash, number, index, block.Hash(), block.NumberU64(), i)
+		}
+		if txn.Hash() != tx.Hash() || txn.Data() != tx.Data() {
+			t.Fatalf("tx #%x: transaction mismatch: have %v, want %v", tx.Hash(), txn.Data(), tx.Data())
+		}
+	}
+
+	for _, tx := range txs {
+		DeleteTxLookupEntry(db, tx.Hash())
+		if txn, _, _, _ := ReadTransaction(db, tx.Hash()); txn != nil {
+			t.Fatalf("tx #%x: deleted transaction returned: %v", tx.Hash(), txn)
+		}
+	}
+}
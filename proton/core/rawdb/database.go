@@ -1,6 +1,13 @@
 package rawdb
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/czh0526/perception/common"
 	"github.com/czh0526/perception/db/leveldb"
 	"github.com/czh0526/perception/db/memorydb"
 	"github.com/czh0526/perception/proton/chaindb"
@@ -29,3 +36,103 @@ func NewDatabase(db chaindb.KeyValueStore) chaindb.Database {
 		KeyValueStore: db,
 	}
 }
+
+// 按 schema 中的前缀分类统计数据库中的数据
+func InspectDatabase(db chaindb.Database, w io.Writer) error {
+	it := db.NewIterator()
+	defer it.Release()
+
+	var (
+		count  int64
+		start  = time.Now()
+		logged = time.Now()
+
+		total           common.StorageSize
+		headerSize      common.StorageSize
+		bodySize        common.StorageSize
+		tdSize          common.StorageSize
+		numHashPairing  common.StorageSize
+		hashNumPairing  common.StorageSize
+		trieSize        common.StorageSize
+		preimageSize    common.StorageSize
+		txLookupSize    common.StorageSize
+		metadataSize    common.StorageSize
+		unaccountedSize common.StorageSize
+
+		headerCount, bodyCount, tdCount, numHashCount, hashNumCount int64
+		trieCount, preimageCount, txLookupCount, metadataCount      int64
+		unaccountedCount                                            int64
+	)
+	for it.Next() {
+		var (
+			key  = it.Key()
+			size = common.StorageSize(len(key) + len(it.Value()))
+		)
+		total += size
+		switch {
+		case bytes.HasPrefix(key, headerPrefix) && len(key) == (len(headerPrefix)+8+common.HashLength):
+			headerSize += size
+			headerCount++
+		case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerTDSuffix) && len(key) == (len(headerPrefix)+8+common.HashLength+len(headerTDSuffix)):
+			tdSize += size
+			tdCount++
+		case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerHashSuffix) && len(key) == (len(headerPrefix)+8+len(headerHashSuffix)):
+			numHashPairing += size
+			numHashCount++
+		case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
+			hashNumPairing += size
+			hashNumCount++
+		case bytes.HasPrefix(key, blockBodyPrefix) && len(key) == (len(blockBodyPrefix)+8+common.HashLength):
+			bodySize += size
+			bodyCount++
+		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
+			txLookupSize += size
+			txLookupCount++
+		case bytes.HasPrefix(key, preimagePrefix) && len(key) == (len(preimagePrefix)+common.HashLength):
+			preimageSize += size
+			preimageCount++
+		case len(key) == common.HashLength:
+			// trie 节点和合约代码都以 hash 作为键
+			trieSize += size
+			trieCount++
+		case bytes.Equal(key, headHeaderKey) || bytes.Equal(key, headBlockKey) || bytes.Equal(key, badBlockKey):
+			metadataSize += size
+			metadataCount++
+		default:
+			unaccountedSize += size
+			unaccountedCount++
+		}
+		count++
+		if count%1000 == 0 && time.Since(logged) > 8*time.Second {
+			fmt.Fprintf(w, "Inspecting database, count = %d, elapsed = %v \n", count, common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CATEGORY\tITEMS\tSIZE")
+	stats := []struct {
+		category string
+		count    int64
+		size     common.StorageSize
+	}{
+		{"Headers", headerCount, headerSize},
+		{"Bodies", bodyCount, bodySize},
+		{"Difficulties", tdCount, tdSize},
+		{"Block number->hash", numHashCount, numHashPairing},
+		{"Block hash->number", hashNumCount, hashNumPairing},
+		{"Trie nodes & code", trieCount, trieSize},
+		{"Trie preimages", preimageCount, preimageSize},
+		{"Transaction index", txLookupCount, txLookupSize},
+		{"Metadata", metadataCount, metadataSize},
+		{"Unaccounted", unaccountedCount, unaccountedSize},
+	}
+	for _, stat := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%v\n", stat.category, stat.count, stat.size)
+	}
+	fmt.Fprintf(tw, "Total\t%d\t%v\n", count, total)
+	return tw.Flush()
+}
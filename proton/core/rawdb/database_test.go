@@ -0,0 +1,64 @@
+package rawdb
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/czh0526/perception/common"
+)
+
+func TestInspectDatabase(t *testing.T) {
+	db := NewMemoryDatabase()
+	hash := common.Hash{0x01}
+
+	// 每一类写入一个键, 值的长度各不相同
+	entries := []struct {
+		category string
+		key      []byte
+		value    []byte
+	}{
+		{"Headers", headerKey(1, hash), make([]byte, 10)},
+		{"Bodies", blockBodyKey(1, hash), make([]byte, 20)},
+		{"Difficulties", headerTDKey(1, hash), make([]byte, 3)},
+		{"Block number->hash", headerHashKey(1), hash.Bytes()},
+		{"Block hash->number", headerNumberKey(hash), encodeBlockNumber(1)},
+		{"Trie nodes & code", common.Hash{0x02}.Bytes(), make([]byte, 40)},
+		{"Trie preimages", append(append([]byte{}, preimagePrefix...), hash.Bytes()...), make([]byte, 20)},
+		{"Transaction index", txLookupKey(hash), encodeBlockNumber(1)},
+		{"Metadata", headHeaderKey, hash.Bytes()},
+		{"Unaccounted", []byte("unknown"), []byte{0x01}},
+	}
+	var total common.StorageSize
+	for _, entry := range entries {
+		if err := db.Put(entry.key, entry.value); err != nil {
+			t.Fatalf("failed to write %s: %v", entry.category, err)
+		}
+		total += common.StorageSize(len(entry.key) + len(entry.value))
+	}
+
+	var out bytes.Buffer
+	if err := InspectDatabase(db, &out); err != nil {
+		t.Fatalf("failed to inspect database: %v", err)
+	}
+
+	// 表格的列之间至少间隔两个空格
+	rows := make(map[string][2]string)
+	sep := regexp.MustCompile(`\s{2,}`)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if cols := sep.Split(strings.TrimSpace(line), -1); len(cols) == 3 {
+			rows[cols[0]] = [2]string{cols[1], cols[2]}
+		}
+	}
+	for _, entry := range entries {
+		size := common.StorageSize(len(entry.key) + len(entry.value)).String()
+		if have := rows[entry.category]; have != [2]string{"1", size} {
+			t.Errorf("%s mismatch: have %v, want [1 %s]", entry.category, have, size)
+		}
+	}
+	if have := rows["Total"]; have != [2]string{strconv.Itoa(len(entries)), total.String()} {
+		t.Errorf("total mismatch: have %v, want [%d %s]", have, len(entries), total)
+	}
+}
@@ -9,6 +9,7 @@ import (
 var (
 	headHeaderKey = []byte("LastHeader")
 	headBlockKey  = []byte("LastBlock")
+	badBlockKey   = []byte("InvalidBlock")
 
 	headerNumberPrefix = []byte("H") // 'H' + hash -> num (uint64 big endian)
 	headerPrefix       = []byte("h") // 'h' + num (uint64 big endian) + hash -> header
@@ -16,6 +17,9 @@ var (
 	headerHashSuffix   = []byte("n") // 'h' + num (uint64 big endian) + 'n' -> hash
 
 	blockBodyPrefix = []byte("b")
+	txLookupPrefix  = []byte("l") // 'l' + tx hash -> block number (uint64 big endian)
+
+	preimagePrefix = []byte("secure-key-") // 与 trie.Database 中的 secureKeyPrefix 保持一致
 )
 
 const (
@@ -56,3 +60,8 @@ func headerTDKey(number uint64, hash common.Hash) []byte {
 func blockBodyKey(number uint64, hash common.Hash) []byte {
 	return append(append(blockBodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
+
+// txLookupKey = 'l' + <hash>
+func txLookupKey(hash common.Hash) []byte {
+	return append(txLookupPrefix, hash.Bytes()...)
+}
@@ -32,6 +32,9 @@ type Trie interface {
 	Commit(onleaf trie.LeafCallback) (common.Hash, error)
 
 	NodeIterator(startKey []byte) trie.NodeIterator
+
+	// 为 key 构造 merkle proof, proof 中的节点写入 proofDb
+	Prove(key []byte, fromLevel uint, proofDb chaindb.KeyValueWriter) error
 }
 
 func NewDatabase(db chaindb.Database) Database {
@@ -0,0 +1,118 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/proton/trie"
+	"github.com/czh0526/perception/rlp"
+)
+
+// DumpAccount 是 dump 中单个账户的格式
+type DumpAccount struct {
+	Balance  string                 `json:"balance"`
+	Nonce    uint64                 `json:"nonce"`
+	Root     string                 `json:"root"`
+	CodeHash string                 `json:"codeHash"`
+	Code     string                 `json:"code,omitempty"`
+	Storage  map[common.Hash]string `json:"storage,omitempty"`
+	// 账户在 secure trie 中的 key, 只有找不到 preimage 时才会设置
+	SecureKey string `json:"key,omitempty"`
+}
+
+// Dump 是整个状态的 dump, 账户以地址为 key, 找不到 preimage 的账户以 secure key 为 key
+type Dump struct {
+	Root     string                 `json:"root"`
+	Accounts map[string]DumpAccount `json:"accounts"`
+}
+
+// IteratorDump 是分页的 dump, Next 是下一页的起始 secure key, 已经遍历完时为空
+type IteratorDump struct {
+	Root     string                 `json:"root"`
+	Accounts map[string]DumpAccount `json:"accounts"`
+	Next     hexutil.Bytes          `json:"next,omitempty"`
+}
+
+// 遍历 state trie, 从 secure key start 开始最多收集 maxResults 个账户, maxResults <= 0 表示不限制.
+// 返回值 next 是下一个未收集的账户的 secure key
+func (self *StateDB) dump(accounts map[string]DumpAccount, start []byte, maxResults int, excludeCode, excludeStorage bool) (next []byte) {
+	it := trie.NewIterator(self.trie.NodeIterator(start))
+	for it.Next() {
+		if maxResults > 0 && len(accounts) >= maxResults {
+			return common.CopyBytes(it.Key)
+		}
+
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			panic(err)
+		}
+		account := DumpAccount{
+			Balance:  data.Balance.String(),
+			Nonce:    data.Nonce,
+			Root:     common.Bytes2Hex(data.Root[:]),
+			CodeHash: common.Bytes2Hex(data.CodeHash),
+		}
+
+		key := fmt.Sprintf("pre(%x)", it.Key)
+		addrBytes := self.trie.GetKey(it.Key)
+		if addrBytes == nil {
+			account.SecureKey = common.Bytes2Hex(it.Key)
+		} else {
+			key = common.BytesToAddress(addrBytes).Hex()
+		}
+
+		obj := newObject(nil, common.BytesToAddress(addrBytes), data)
+		if !excludeCode {
+			account.Code = common.Bytes2Hex(obj.Code(self.db))
+		}
+		if !excludeStorage {
+			account.Storage = make(map[common.Hash]string)
+			storageIt := trie.NewIterator(obj.getTrie(self.db).NodeIterator(nil))
+			for storageIt.Next() {
+				_, content, _, err := rlp.Split(storageIt.Value)
+				if err != nil {
+					continue
+				}
+				// 找不到 preimage 时以 secure key 代替
+				slot := self.trie.GetKey(storageIt.Key)
+				if slot == nil {
+					slot = storageIt.Key
+				}
+				account.Storage[common.BytesToHash(slot)] = common.Bytes2Hex(content)
+			}
+		}
+		accounts[key] = account
+	}
+	return nil
+}
+
+// RawDump 返回状态中全部账户的 dump
+func (self *StateDB) RawDump(excludeCode, excludeStorage bool) Dump {
+	dump := Dump{
+		Root:     fmt.Sprintf("%x", self.trie.Hash()),
+		Accounts: make(map[string]DumpAccount),
+	}
+	self.dump(dump.Accounts, nil, 0, excludeCode, excludeStorage)
+	return dump
+}
+
+// IteratorDump 从 secure key start 开始返回最多 maxResults 个账户的 dump
+func (self *StateDB) IteratorDump(start []byte, maxResults int, excludeCode, excludeStorage bool) IteratorDump {
+	dump := IteratorDump{
+		Root:     fmt.Sprintf("%x", self.trie.Hash()),
+		Accounts: make(map[string]DumpAccount),
+	}
+	dump.Next = self.dump(dump.Accounts, start, maxResults, excludeCode, excludeStorage)
+	return dump
+}
+
+// StorageTrie 返回账户的 storage trie 的副本, 账户不存在时返回 nil
+func (self *StateDB) StorageTrie(addr common.Address) Trie {
+	stateObject := self.getStateObject(addr)
+	if stateObject == nil {
+		return nil
+	}
+	cpy := newObject(self, addr, stateObject.data)
+	return cpy.getTrie(self.db)
+}
@@ -135,6 +135,10 @@ func (s *stateObject) Balance() *big.Int {
 	return s.data.Balance
 }
 
+func (s *stateObject) Nonce() uint64 {
+	return s.data.Nonce
+}
+
 func (s *stateObject) AddBalance(amount *big.Int) {
 	if amount.Sign() == 0 {
 		return
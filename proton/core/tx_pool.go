@@ -0,0 +1,147 @@
+package core
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/event"
+	"github.com/czh0526/perception/proton/core/rawdb"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rlp"
+)
+
+const (
+	// 单笔交易编码后的最大字节数
+	txMaxSize = 32 * 1024
+
+	// 交易池中最多容纳的交易数量
+	txPoolSlots = 4096
+)
+
+var (
+	// 交易已经在交易池或者区块链中
+	ErrAlreadyKnown = errors.New("already known")
+
+	// 交易编码后超出了 txMaxSize
+	ErrOversizedData = errors.New("oversized data")
+
+	// 交易池已满
+	ErrTxPoolOverflow = errors.New("txpool is full")
+)
+
+// TxPool 保存尚未打包进区块的交易, 按照加入的顺序排列.
+// 交易被打包进 canonical 区块之后, 在下一次读取 pending 列表时从池中移除.
+type TxPool struct {
+	chain *BlockChain
+
+	mu      sync.RWMutex
+	all     map[common.Hash]*types.Transaction
+	pending []common.Hash
+
+	txFeed event.Feed
+	scope  event.SubscriptionScope
+}
+
+func NewTxPool(chain *BlockChain) *TxPool {
+	return &TxPool{
+		chain: chain,
+		all:   make(map[common.Hash]*types.Transaction),
+	}
+}
+
+// 校验交易并加入交易池
+func (pool *TxPool) AddLocal(tx *types.Transaction) error {
+	if err := pool.validateTx(tx); err != nil {
+		return err
+	}
+
+	if err := pool.add(tx); err != nil {
+		return err
+	}
+	// 在锁之外发送事件, 避免订阅者回调交易池时死锁
+	pool.txFeed.Send(NewTxsEvent{Txs: []*types.Transaction{tx}})
+	return nil
+}
+
+func (pool *TxPool) add(tx *types.Transaction) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	hash := tx.Hash()
+	if pool.all[hash] != nil {
+		return ErrAlreadyKnown
+	}
+	if len(pool.all) >= txPoolSlots {
+		pool.demoteIncluded()
+		if len(pool.all) >= txPoolSlots {
+			return ErrTxPoolOverflow
+		}
+	}
+	pool.all[hash] = tx
+	pool.pending = append(pool.pending, hash)
+	return nil
+}
+
+// 订阅新加入交易池的交易
+func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.txFeed.Subscribe(ch))
+}
+
+// 结束所有的事件订阅
+func (pool *TxPool) Stop() {
+	pool.scope.Close()
+}
+
+func (pool *TxPool) validateTx(tx *types.Transaction) error {
+	enc, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return err
+	}
+	if len(enc) > txMaxSize {
+		return ErrOversizedData
+	}
+	if pool.included(tx.Hash()) {
+		return ErrAlreadyKnown
+	}
+	return nil
+}
+
+// 交易是否已经被打包进 canonical 区块
+func (pool *TxPool) included(hash common.Hash) bool {
+	return rawdb.ReadTxLookupEntry(pool.chain.db, hash) != nil
+}
+
+// 移除已经被打包的交易, 调用者需要持有 pool.mu
+func (pool *TxPool) demoteIncluded() {
+	pending := pool.pending[:0]
+	for _, hash := range pool.pending {
+		if pool.included(hash) {
+			delete(pool.all, hash)
+			continue
+		}
+		pending = append(pending, hash)
+	}
+	pool.pending = pending
+}
+
+// 返回交易池中的交易, 不存在时返回 nil
+func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.all[hash]
+}
+
+// 返回尚未被打包的交易, 按加入交易池的顺序排列
+func (pool *TxPool) Pending() types.Transactions {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.demoteIncluded()
+	txs := make(types.Transactions, 0, len(pool.pending))
+	for _, hash := range pool.pending {
+		txs = append(txs, pool.all[hash])
+	}
+	return txs
+}
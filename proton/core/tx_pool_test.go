@@ -0,0 +1,53 @@
+package core
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/czh0526/perception/proton/core/types"
+)
+
+func TestTxPoolAdd(t *testing.T) {
+	bc, genesis := newTestBlockChain(t)
+	defer bc.Stop()
+	pool := NewTxPool(bc)
+
+	tx1, tx2 := types.NewTransaction("tx1"), types.NewTransaction("tx2")
+	if err := pool.AddLocal(tx1); err != nil {
+		t.Fatalf("failed to add tx: %v", err)
+	}
+	if err := pool.AddLocal(tx2); err != nil {
+		t.Fatalf("failed to add tx: %v", err)
+	}
+	if err := pool.AddLocal(tx1); err != ErrAlreadyKnown {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrAlreadyKnown)
+	}
+	if err := pool.AddLocal(types.NewTransaction(strings.Repeat("x", txMaxSize))); err != ErrOversizedData {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrOversizedData)
+	}
+	if pending := pool.Pending(); len(pending) != 2 || pending[0].Hash() != tx1.Hash() || pending[1].Hash() != tx2.Hash() {
+		t.Fatalf("pending mismatch: have %v", pending)
+	}
+
+	// tx1 被打包之后从交易池中移除, 并且不能再次加入
+	block := makePastChain(genesis, 1)[0]
+	block = types.NewBlock(&types.Header{
+		ParentHash: block.ParentHash(),
+		Number:     big.NewInt(1),
+		Root:       block.Root(),
+		Time:       block.Time(),
+	}, []*types.Transaction{tx1}, nil)
+	if _, err := bc.InsertChain([]*types.Block{block}); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if pending := pool.Pending(); len(pending) != 1 || pending[0].Hash() != tx2.Hash() {
+		t.Fatalf("pending mismatch after inclusion: have %v", pending)
+	}
+	if pool.Get(tx1.Hash()) != nil {
+		t.Fatalf("included tx still in pool")
+	}
+	if err := pool.AddLocal(tx1); err != ErrAlreadyKnown {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrAlreadyKnown)
+	}
+}
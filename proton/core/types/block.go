@@ -6,6 +6,7 @@ import (
 	"sync/atomic"
 
 	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
 	"github.com/czh0526/perception/rlp"
 	"golang.org/x/crypto/sha3"
 )
@@ -14,6 +15,8 @@ var (
 	EmptyRootHash = DeriveSha(Transactions{})
 )
 
+//go:generate gencodec -type Header -field-override headerMarshaling -out gen_header_json.go
+
 type Header struct {
 	ParentHash common.Hash `json:"parentHash" gencodec:"required"`
 	Number     *big.Int    `json:"number" gencodec:"required"`
@@ -22,6 +25,13 @@ type Header struct {
 	Time       uint64      `json:"timestamp" gencodec:"required"`
 }
 
+// field type overrides for gencodec
+type headerMarshaling struct {
+	Number *hexutil.Big
+	Time   hexutil.Uint64
+	Hash   common.Hash `json:"hash"` // adds call to Hash() in MarshalJSON
+}
+
 func (h *Header) Hash() common.Hash {
 	return rlpHash(h)
 }
@@ -104,6 +114,9 @@ func (b *Block) Header() *Header         { return CopyHeader(b.header) }
 func (b *Block) Body() *Body             { return &Body{b.transactions} }
 func (b *Block) Root() common.Hash       { return b.header.Root }
 func (b *Block) ParentHash() common.Hash { return b.header.ParentHash }
+func (b *Block) TxHash() common.Hash     { return b.header.TxHash }
+
+func (b *Block) Transactions() Transactions { return b.transactions }
 
 func (b *Block) EncodeRLP(w io.Writer) error {
 	return rlp.Encode(w, extblock{
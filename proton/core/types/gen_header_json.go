@@ -0,0 +1,70 @@
+// Code generated by github.com/fjl/gencodec. DO NOT EDIT.
+
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+)
+
+var _ = (*headerMarshaling)(nil)
+
+// MarshalJSON marshals as JSON.
+func (h Header) MarshalJSON() ([]byte, error) {
+	type Header struct {
+		ParentHash common.Hash    `json:"parentHash" gencodec:"required"`
+		Number     *hexutil.Big   `json:"number" gencodec:"required"`
+		Root       common.Hash    `json:"stateRoot" gencodec:"required"`
+		TxHash     common.Hash    `json:"transactionsRoot" gencodec:"required"`
+		Time       hexutil.Uint64 `json:"timestamp" gencodec:"required"`
+		Hash       common.Hash    `json:"hash"`
+	}
+	var enc Header
+	enc.ParentHash = h.ParentHash
+	enc.Number = (*hexutil.Big)(h.Number)
+	enc.Root = h.Root
+	enc.TxHash = h.TxHash
+	enc.Time = hexutil.Uint64(h.Time)
+	enc.Hash = h.Hash()
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON unmarshals from JSON.
+func (h *Header) UnmarshalJSON(input []byte) error {
+	type Header struct {
+		ParentHash *common.Hash    `json:"parentHash" gencodec:"required"`
+		Number     *hexutil.Big    `json:"number" gencodec:"required"`
+		Root       *common.Hash    `json:"stateRoot" gencodec:"required"`
+		TxHash     *common.Hash    `json:"transactionsRoot" gencodec:"required"`
+		Time       *hexutil.Uint64 `json:"timestamp" gencodec:"required"`
+	}
+	var dec Header
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.ParentHash == nil {
+		return errors.New("missing required field 'parentHash' for Header")
+	}
+	h.ParentHash = *dec.ParentHash
+	if dec.Number == nil {
+		return errors.New("missing required field 'number' for Header")
+	}
+	h.Number = (*big.Int)(dec.Number)
+	if dec.Root == nil {
+		return errors.New("missing required field 'stateRoot' for Header")
+	}
+	h.Root = *dec.Root
+	if dec.TxHash == nil {
+		return errors.New("missing required field 'transactionsRoot' for Header")
+	}
+	h.TxHash = *dec.TxHash
+	if dec.Time == nil {
+		return errors.New("missing required field 'timestamp' for Header")
+	}
+	h.Time = uint64(*dec.Time)
+	return nil
+}
@@ -0,0 +1,35 @@
+package types
+
+import (
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+)
+
+//go:generate gencodec -type Log -field-override logMarshaling -out gen_log_json.go
+
+// Log 是交易执行过程中产生的事件记录
+type Log struct {
+	// 产生事件的合约地址
+	Address common.Address `json:"address" gencodec:"required"`
+	// 事件的主题列表
+	Topics []common.Hash `json:"topics" gencodec:"required"`
+	// 事件的数据
+	Data []byte `json:"data" gencodec:"required"`
+
+	// 以下字段由区块链填充, 不参与共识
+	BlockNumber uint64      `json:"blockNumber"`
+	TxHash      common.Hash `json:"transactionHash" gencodec:"required"`
+	TxIndex     uint        `json:"transactionIndex" gencodec:"required"`
+	BlockHash   common.Hash `json:"blockHash"`
+	Index       uint        `json:"logIndex" gencodec:"required"`
+
+	// 区块因链重组被移出 canonical 链时, 其中的日志以 Removed = true 再次通知
+	Removed bool `json:"removed"`
+}
+
+type logMarshaling struct {
+	Data        hexutil.Bytes
+	BlockNumber hexutil.Uint64
+	TxIndex     hexutil.Uint
+	Index       hexutil.Uint
+}
@@ -1,5 +1,12 @@
 package types
 
+import (
+	"io"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/rlp"
+)
+
 type Transaction struct {
 	data txdata
 }
@@ -7,3 +14,22 @@ type Transaction struct {
 type txdata struct {
 	Dummy string `json:"dummy" gencodec:"required"`
 }
+
+func NewTransaction(data string) *Transaction {
+	return &Transaction{data: txdata{Dummy: data}}
+}
+
+func (tx *Transaction) Data() string { return tx.data.Dummy }
+
+// 交易的哈希, 由交易内容的 rlp 编码计算得到
+func (tx *Transaction) Hash() common.Hash {
+	return rlpHash(tx.data)
+}
+
+func (tx *Transaction) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, &tx.data)
+}
+
+func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
+	return s.Decode(&tx.data)
+}
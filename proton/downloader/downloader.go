@@ -48,8 +48,10 @@ type Downloader struct {
 	blockchain BlockChain
 	chaindb    chaindb.Database
 
-	dropPeer peerDropFn
-	queue    sortedBlocks
+	dropPeer  peerDropFn
+	badBlock  badBlockFn
+	queue     sortedBlocks
+	queueLock sync.Mutex
 
 	blockCh     chan dataPack
 	blockProcCh chan []*types.Block
@@ -66,11 +68,12 @@ type BlockChain interface {
 	InsertChain([]*types.Block) (int, error)
 }
 
-func New(chainDb chaindb.Database, blockChain BlockChain, dropPeer peerDropFn) *Downloader {
+func New(chainDb chaindb.Database, blockChain BlockChain, dropPeer peerDropFn, badBlock badBlockFn) *Downloader {
 	dl := &Downloader{
 		chaindb:     chainDb,
 		blockchain:  blockChain,
 		dropPeer:    dropPeer,
+		badBlock:    badBlock,
 		blockCh:     make(chan dataPack, 1),
 		blockProcCh: make(chan []*types.Block, 1),
 		peers:       newPeerSet(),
@@ -99,6 +102,11 @@ func (d *Downloader) UnregisterPeer(id string) error {
 	return nil
 }
 
+// 同步是否因为节点响应超时而失败
+func IsTimeout(err error) bool {
+	return err == errTimeout
+}
+
 func (d *Downloader) Synchronise(id string, head common.Hash, number *big.Int) error {
 	err := d.synchronise(id, head, number)
 	switch err {
@@ -107,7 +115,7 @@ func (d *Downloader) Synchronise(id string, head common.Hash, number *big.Int) e
 	case errTimeout, errBadPeer, errStallingPeer, errUnsyncedPeer,
 		errEmptyHeaderSet, errPeersUnavailable, errTooOld, errInvalidChain:
 		if d.dropPeer != nil {
-			d.dropPeer(id)
+			d.dropPeer(id, err)
 		}
 	default:
 		log.Printf("Synchronisation failed, retrying, err = %v \n", err)
@@ -132,7 +140,7 @@ func (d *Downloader) synchronise(id string, hash common.Hash, number *big.Int) e
 
 func (d *Downloader) syncWithPeer(p *peerConnection, remoteHeadHash common.Hash, remoteHeadNumber *big.Int) (err error) {
 
-	localHeadNumber := d.blockchain.CurrentHeader().Number
+	localHeadNumber := d.blockchain.CurrentBlock().Number()
 	log.Printf("5). Downloader.syncWithPeer() started, local head = %v, remote head = %v \n", localHeadNumber, remoteHeadNumber)
 	origin := new(big.Int).Add(localHeadNumber, big.NewInt(1))
 	if localHeadNumber.Cmp(remoteHeadNumber) > 0 {
@@ -238,7 +246,9 @@ func (d *Downloader) fetchBlocks(p *peerConnection, from uint64, end uint64) err
 
 			blocks := packet.(*blockPack).blocks
 			if len(blocks) > 0 {
-				d.processBlocks(blocks)
+				if err := d.processBlocks(p.id, blocks); err != nil {
+					return err
+				}
 				from += uint64(len(blocks))
 				if from < end {
 					getBlocks(from, end)
@@ -285,28 +295,41 @@ func (d *Downloader) deliver(id string, destCh chan dataPack, packet dataPack) (
 	}
 }
 
-func (d *Downloader) processBlocks(blocks []*types.Block) {
-
+func (d *Downloader) processBlocks(id string, blocks []*types.Block) error {
 	if len(blocks) == 0 {
-		return
+		return nil
 	}
 
-	inserted := 0
-	log.Printf("block[0].Number = %v, chain current block = %v", blocks[0].NumberU64(), d.blockchain.CurrentBlock().NumberU64())
-	if blocks[0].NumberU64() == d.blockchain.CurrentBlock().NumberU64()+1 {
-		inserted, _ = d.blockchain.InsertChain(blocks)
-		log.Printf("inserted = %v", inserted)
-		if inserted > 0 {
-			futureBlocks := d.queue.peekContinuousBlocks()
-			n, _ := d.blockchain.InsertChain(futureBlocks)
-			log.Printf("n = %v", n)
-			d.queue.pop(n)
+	d.queueLock.Lock()
+	defer d.queueLock.Unlock()
+
+	// 与本地链不连续的区块先放入队列
+	d.queue.insert(blocks)
+	for {
+		head := d.blockchain.CurrentBlock().NumberU64()
+		d.queue.prune(head)
+
+		next := d.queue.peekContinuousBlocks(head + 1)
+		if len(next) == 0 {
+			break
+		}
+		inserted, err := d.blockchain.InsertChain(next)
+		log.Printf("inserted = %v, err = %v", inserted, err)
+		if err != nil {
+			// 丢弃校验失败的区块以及之后的区块
+			if d.badBlock != nil && inserted < len(next) {
+				d.badBlock(id, next[inserted], err)
+			}
+			d.queue.pop(len(d.queue))
+			return errInvalidChain
+		}
+		d.queue.pop(inserted)
+		if inserted == 0 || d.blockchain.CurrentBlock().NumberU64() == head {
+			// 区块被 blockchain 暂存 (future/unknown parent)，等待下一次处理
+			break
 		}
 	}
 	log.Printf("blockchain head block is: %v \n", d.blockchain.CurrentBlock().NumberU64())
 	log.Printf("blockchain head header is: %v \n", d.blockchain.CurrentHeader().Number)
-
-	if inserted == 0 {
-		d.queue.insert(blocks)
-	}
+	return nil
 }
@@ -20,30 +20,45 @@ func (sb sortedBlocks) Less(i, j int) bool {
 	return sb[i].NumberU64() < sb[j].NumberU64()
 }
 
-func (sb sortedBlocks) insert(blocks []*types.Block) {
-	sb = append(sb, blocks...)
-	sort.Sort(sb)
+func (sb *sortedBlocks) insert(blocks []*types.Block) {
+	known := make(map[uint64]struct{}, len(*sb))
+	for _, block := range *sb {
+		known[block.NumberU64()] = struct{}{}
+	}
+	for _, block := range blocks {
+		if _, exists := known[block.NumberU64()]; exists {
+			continue
+		}
+		known[block.NumberU64()] = struct{}{}
+		*sb = append(*sb, block)
+	}
+	sort.Sort(*sb)
 }
 
-func (sb sortedBlocks) pop(n int) {
-	sb = sb[n:]
+func (sb *sortedBlocks) pop(n int) {
+	if n > len(*sb) {
+		n = len(*sb)
+	}
+	*sb = (*sb)[n:]
 }
 
-func (sb sortedBlocks) peekContinuousBlocks() []*types.Block {
-	var parentNum uint64 = 0
-	var (
-		pos   int
-		block *types.Block
-	)
-	for pos, block = range sb {
-		if parentNum == 0 {
-			parentNum = block.NumberU64()
-		} else {
-			if parentNum+1 != block.NumberU64() {
-				break
-			}
-		}
+// 丢弃编号不大于 head 的区块
+func (sb *sortedBlocks) prune(head uint64) {
+	n := 0
+	for n < len(*sb) && (*sb)[n].NumberU64() <= head {
+		n++
 	}
+	sb.pop(n)
+}
 
+// 返回从 next 开始的连续区块
+func (sb sortedBlocks) peekContinuousBlocks(next uint64) []*types.Block {
+	if len(sb) == 0 || sb[0].NumberU64() != next {
+		return nil
+	}
+	pos := 1
+	for pos < len(sb) && sb[pos].NumberU64() == sb[pos-1].NumberU64()+1 {
+		pos++
+	}
 	return sb[:pos]
 }
@@ -6,7 +6,10 @@ import (
 	"github.com/czh0526/perception/proton/core/types"
 )
 
-type peerDropFn func(id string)
+// 同步出错时断开节点, err 是出错的原因
+type peerDropFn func(id string, err error)
+
+type badBlockFn func(id string, block *types.Block, err error)
 
 type dataPack interface {
 	PeerId() string
@@ -0,0 +1,287 @@
+package filters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/event"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rpc"
+)
+
+const (
+	// 订阅通道的缓冲大小
+	txChanSize      = 4096
+	chainEvChanSize = 10
+	logsChanSize    = 10
+	rmLogsChanSize  = 10
+)
+
+// Backend 提供订阅所需的事件源
+type Backend interface {
+	SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
+	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
+}
+
+// PublicFilterAPI 提供基于 WebSocket/IPC 的事件订阅, 注册在 proton 命名空间下.
+// 每个订阅内部使用一个 event.SubscriptionScope 管理对 Backend 的事件订阅,
+// 客户端取消订阅或者断开连接时一并结束.
+type PublicFilterAPI struct {
+	backend Backend
+}
+
+func NewPublicFilterAPI(backend Backend) *PublicFilterAPI {
+	return &PublicFilterAPI{backend: backend}
+}
+
+// NewHeads 在每次链头变化时发送新的区块头, 包括短暂出现的分叉区块
+func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	var scope event.SubscriptionScope
+	headers := make(chan core.ChainHeadEvent, chainEvChanSize)
+	headersSub := scope.Track(api.backend.SubscribeChainHeadEvent(headers))
+
+	go func() {
+		defer scope.Close()
+		for {
+			select {
+			case ev := <-headers:
+				notifier.Notify(rpcSub.ID, ev.Block.Header())
+			case <-headersSub.Err():
+				return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// NewPendingTransactions 在交易进入交易池时发送交易的哈希
+func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	var scope event.SubscriptionScope
+	txs := make(chan core.NewTxsEvent, txChanSize)
+	txsSub := scope.Track(api.backend.SubscribeNewTxsEvent(txs))
+
+	go func() {
+		defer scope.Close()
+		for {
+			select {
+			case ev := <-txs:
+				for _, tx := range ev.Txs {
+					notifier.Notify(rpcSub.ID, tx.Hash())
+				}
+			case <-txsSub.Err():
+				return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// Logs 发送符合过滤条件的日志, 因链重组被移除的日志以 removed = true 再次发送.
+// 注意: 目前区块中的交易不会被执行, 没有交易产生日志, 所以该订阅永远不会收到通知.
+// 保留该接口是为了兼容调用方, 交易执行实现之后由 BlockChain 的 logsFeed 和 rmLogsFeed 发送日志.
+func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+	log.Printf("Logs subscription %s created, no transaction produces logs yet, it will not receive notifications", rpcSub.ID)
+
+	var scope event.SubscriptionScope
+	logs := make(chan []*types.Log, logsChanSize)
+	rmLogs := make(chan core.RemovedLogsEvent, rmLogsChanSize)
+	logsSub := scope.Track(api.backend.SubscribeLogsEvent(logs))
+	rmLogsSub := scope.Track(api.backend.SubscribeRemovedLogsEvent(rmLogs))
+
+	go func() {
+		defer scope.Close()
+		for {
+			select {
+			case ev := <-logs:
+				for _, log := range filterLogs(ev, crit.Addresses, crit.Topics) {
+					notifier.Notify(rpcSub.ID, log)
+				}
+			case ev := <-rmLogs:
+				for _, log := range filterLogs(ev.Logs, crit.Addresses, crit.Topics) {
+					removed := *log
+					removed.Removed = true
+					notifier.Notify(rpcSub.ID, &removed)
+				}
+			case <-logsSub.Err():
+				return
+			case <-rmLogsSub.Err():
+				return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// FilterCriteria 是日志订阅的过滤条件
+type FilterCriteria struct {
+	// 日志必须来自其中一个地址, 为空时不限制
+	Addresses []common.Address
+	// 每个位置上的主题必须是对应列表中的一个, 列表为空时该位置不限制
+	Topics [][]common.Hash
+}
+
+// UnmarshalJSON 解析过滤条件, address 可以是单个地址或地址数组,
+// topics 中的每一项可以是 null, 单个主题或主题数组
+func (args *FilterCriteria) UnmarshalJSON(data []byte) error {
+	type input struct {
+		Addresses interface{}   `json:"address"`
+		Topics    []interface{} `json:"topics"`
+	}
+
+	var raw input
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if raw.Addresses != nil {
+		switch rawAddr := raw.Addresses.(type) {
+		case []interface{}:
+			for i, addr := range rawAddr {
+				strAddr, ok := addr.(string)
+				if !ok {
+					return fmt.Errorf("non-string address at index %d", i)
+				}
+				address, err := decodeAddress(strAddr)
+				if err != nil {
+					return fmt.Errorf("invalid address at index %d: %v", i, err)
+				}
+				args.Addresses = append(args.Addresses, address)
+			}
+		case string:
+			address, err := decodeAddress(rawAddr)
+			if err != nil {
+				return fmt.Errorf("invalid address: %v", err)
+			}
+			args.Addresses = []common.Address{address}
+		default:
+			return errors.New("invalid addresses in query")
+		}
+	}
+
+	args.Topics = make([][]common.Hash, len(raw.Topics))
+	for i, t := range raw.Topics {
+		switch topic := t.(type) {
+		case nil:
+			// 该位置不限制
+
+		case string:
+			hash, err := decodeTopic(topic)
+			if err != nil {
+				return err
+			}
+			args.Topics[i] = []common.Hash{hash}
+
+		case []interface{}:
+			for _, rawTopic := range topic {
+				if rawTopic == nil {
+					// 列表中出现 null 时该位置不限制
+					args.Topics[i] = nil
+					break
+				}
+				str, ok := rawTopic.(string)
+				if !ok {
+					return errors.New("invalid topic(s)")
+				}
+				hash, err := decodeTopic(str)
+				if err != nil {
+					return err
+				}
+				args.Topics[i] = append(args.Topics[i], hash)
+			}
+		default:
+			return errors.New("invalid topic(s)")
+		}
+	}
+	return nil
+}
+
+func decodeAddress(s string) (common.Address, error) {
+	b, err := hexutil.Decode(s)
+	if err == nil && len(b) != common.AddressLength {
+		err = fmt.Errorf("hex has invalid length %d after decoding; expected %d for address", len(b), common.AddressLength)
+	}
+	return common.BytesToAddress(b), err
+}
+
+func decodeTopic(s string) (common.Hash, error) {
+	b, err := hexutil.Decode(s)
+	if err == nil && len(b) != common.HashLength {
+		err = fmt.Errorf("hex has invalid length %d after decoding; expected %d for topic", len(b), common.HashLength)
+	}
+	return common.BytesToHash(b), err
+}
+
+// filterLogs 返回符合地址和主题条件的日志
+func filterLogs(logs []*types.Log, addresses []common.Address, topics [][]common.Hash) []*types.Log {
+	var ret []*types.Log
+Logs:
+	for _, log := range logs {
+		if len(addresses) > 0 && !includes(addresses, log.Address) {
+			continue
+		}
+		// 条件中的主题数量多于日志的主题数量时, 一定不匹配
+		if len(topics) > len(log.Topics) {
+			continue Logs
+		}
+		for i, sub := range topics {
+			match := len(sub) == 0 // empty rule set == wildcard
+			for _, topic := range sub {
+				if log.Topics[i] == topic {
+					match = true
+					break
+				}
+			}
+			if !match {
+				continue Logs
+			}
+		}
+		ret = append(ret, log)
+	}
+	return ret
+}
+
+func includes(addresses []common.Address, a common.Address) bool {
+	for _, addr := range addresses {
+		if addr == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package filters
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/event"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rpc"
+	"github.com/gorilla/websocket"
+)
+
+type testBackend struct {
+	txFeed     event.Feed
+	headFeed   event.Feed
+	logsFeed   event.Feed
+	rmLogsFeed event.Feed
+}
+
+func (b *testBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return b.txFeed.Subscribe(ch)
+}
+
+func (b *testBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.headFeed.Subscribe(ch)
+}
+
+func (b *testBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return b.logsFeed.Subscribe(ch)
+}
+
+func (b *testBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
+	return b.rmLogsFeed.Subscribe(ch)
+}
+
+type notification struct {
+	Method string `json:"method"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+func newTestConn(t *testing.T, backend Backend) *websocket.Conn {
+	server := rpc.NewServer()
+	if err := server.RegisterName("proton", NewPublicFilterAPI(backend)); err != nil {
+		t.Fatalf("failed to register api: %v", err)
+	}
+	ts := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	t.Cleanup(func() {
+		ts.Close()
+		server.Stop()
+	})
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	return conn
+}
+
+func subscribe(t *testing.T, conn *websocket.Conn, params string) string {
+	req := `{"jsonrpc":"2.0","id":1,"method":"proton_subscribe","params":` + params + `}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	var resp struct {
+		Result string          `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("subscribe failed: %s", resp.Error)
+	}
+	return resp.Result
+}
+
+// 等待 feed 上的订阅者全部就绪, Send 返回收到事件的订阅者数量
+func sendUntil(t *testing.T, feed *event.Feed, value interface{}, want int) {
+	for i := 0; i < 100; i++ {
+		if feed.Send(value) == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("subscriber count never reached %d", want)
+}
+
+func TestNewHeadsSubscription(t *testing.T) {
+	backend := new(testBackend)
+	conn := newTestConn(t, backend)
+
+	id := subscribe(t, conn, `["newHeads"]`)
+	header := &types.Header{Number: big.NewInt(7), Time: 100}
+	sendUntil(t, &backend.headFeed, core.ChainHeadEvent{Block: types.NewBlockWithHeader(header)}, 1)
+
+	var n notification
+	if err := conn.ReadJSON(&n); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if n.Method != "proton_subscription" || n.Params.Subscription != id {
+		t.Fatalf("notification mismatch: have %+v", n)
+	}
+	var got types.Header
+	if err := json.Unmarshal(n.Params.Result, &got); err != nil {
+		t.Fatalf("invalid header: %v", err)
+	}
+	if got.Hash() != header.Hash() {
+		t.Fatalf("header mismatch: have %x, want %x", got.Hash(), header.Hash())
+	}
+
+	// 断开连接之后, 对 backend 的订阅随之结束
+	conn.Close()
+	sendUntil(t, &backend.headFeed, core.ChainHeadEvent{Block: types.NewBlockWithHeader(header)}, 0)
+}
+
+func TestPendingTransactionsSubscription(t *testing.T) {
+	backend := new(testBackend)
+	conn := newTestConn(t, backend)
+	defer conn.Close()
+
+	id := subscribe(t, conn, `["newPendingTransactions"]`)
+	tx := types.NewTransaction("transfer")
+	sendUntil(t, &backend.txFeed, core.NewTxsEvent{Txs: []*types.Transaction{tx}}, 1)
+
+	var n notification
+	if err := conn.ReadJSON(&n); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	var hash common.Hash
+	if err := json.Unmarshal(n.Params.Result, &hash); err != nil || hash != tx.Hash() {
+		t.Fatalf("tx hash mismatch: have %x, want %x (%v)", hash, tx.Hash(), err)
+	}
+
+	// 取消订阅之后, 对 backend 的订阅随之结束
+	req := `{"jsonrpc":"2.0","id":2,"method":"proton_unsubscribe","params":["` + id + `"]}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	var resp struct{ Result bool }
+	if err := conn.ReadJSON(&resp); err != nil || !resp.Result {
+		t.Fatalf("unsubscribe failed: %v", err)
+	}
+	sendUntil(t, &backend.txFeed, core.NewTxsEvent{Txs: []*types.Transaction{tx}}, 0)
+}
+
+func TestLogsSubscription(t *testing.T) {
+	backend := new(testBackend)
+	conn := newTestConn(t, backend)
+	defer conn.Close()
+
+	var (
+		addr1  = common.BytesToAddress([]byte{1})
+		addr2  = common.BytesToAddress([]byte{2})
+		topic1 = common.BytesToHash([]byte{0xa})
+		topic2 = common.BytesToHash([]byte{0xb})
+	)
+	id := subscribe(t, conn, `["logs",{"address":"`+addr1.Hex()+`","topics":[null,["`+topic2.Hex()+`"]]}]`)
+
+	logs := []*types.Log{
+		{Address: addr2, Topics: []common.Hash{topic1, topic2}},
+		{Address: addr1, Topics: []common.Hash{topic1}},
+		{Address: addr1, Topics: []common.Hash{topic1, topic2}, Index: 2},
+	}
+	sendUntil(t, &backend.logsFeed, logs, 1)
+	sendUntil(t, &backend.rmLogsFeed, core.RemovedLogsEvent{Logs: logs}, 1)
+
+	for _, removed := range []bool{false, true} {
+		var n notification
+		if err := conn.ReadJSON(&n); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		var log types.Log
+		if err := json.Unmarshal(n.Params.Result, &log); err != nil {
+			t.Fatalf("invalid log: %v", err)
+		}
+		if n.Params.Subscription != id || log.Index != 2 || log.Removed != removed {
+			t.Fatalf("log mismatch: have %+v", log)
+		}
+	}
+}
+
+func TestSubscriptionOverHTTP(t *testing.T) {
+	server := rpc.NewServer()
+	server.RegisterName("proton", NewPublicFilterAPI(new(testBackend)))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, err := ts.Client().Post(ts.URL, "application/json",
+		strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"proton_subscribe","params":["newHeads"]}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Error struct{ Message string }
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Error.Message != rpc.ErrNotificationsUnsupported.Error() {
+		t.Fatalf("error mismatch: have %q, want %q", result.Error.Message, rpc.ErrNotificationsUnsupported)
+	}
+}
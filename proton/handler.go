@@ -4,38 +4,37 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"math/big"
 	"time"
 
+	"github.com/czh0526/perception/common"
 	"github.com/czh0526/perception/p2p"
 	"github.com/czh0526/perception/proton/chaindb"
 	"github.com/czh0526/perception/proton/core"
 	"github.com/czh0526/perception/proton/core/types"
 	"github.com/czh0526/perception/proton/downloader"
+	libp2p_peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
 type ProtocolManager struct {
 	networkID  uint64
 	blockchain *core.BlockChain
-	maxPeers   int
-	peers      map[string]*peer
+	peers      *peerSet
 	downloader *downloader.Downloader
+	server     *p2p.Server
 }
 
 func NewProtocolManager(networkID uint64, chainDb chaindb.Database, blockChain *core.BlockChain) (*ProtocolManager, error) {
 	manager := &ProtocolManager{
 		networkID:  networkID,
 		blockchain: blockChain,
-		peers:      make(map[string]*peer),
+		peers:      newPeerSet(),
 	}
-	manager.downloader = downloader.New(chainDb, blockChain, manager.removePeer)
+	manager.downloader = downloader.New(chainDb, blockChain, manager.dropPeer, manager.handleBadBlock)
 
 	return manager, nil
 }
 
-func (pm *ProtocolManager) Start(maxPeers int) {
-	pm.maxPeers = maxPeers
-
+func (pm *ProtocolManager) Start() {
 	go pm.syncer()
 }
 
@@ -49,39 +48,65 @@ func (pm *ProtocolManager) syncer() {
 	for {
 		select {
 		case <-forceSync.C:
-			go pm.synchronise(bestPeer(pm.peers))
+			go pm.synchronise(pm.peers.BestPeer())
 		}
 	}
 }
 
-func bestPeer(peers map[string]*peer) *peer {
-	var (
-		bestPeer *peer
-		bestNum  *big.Int = big.NewInt(0)
-	)
-	for _, p := range peers {
-		if _, num := p.Head(); bestNum.Cmp(big.NewInt(0)) == 0 || num.Cmp(bestNum) > 0 {
-			bestPeer, bestNum = p, num
-		}
+// 断开节点, 节点的注册在 handle 返回时被注销
+func (pm *ProtocolManager) removePeer(id string) {
+	if peer := pm.peers.Peer(id); peer != nil {
+		peer.close(p2p.DiscUselessPeer)
 	}
-	return bestPeer
 }
 
-func (pm *ProtocolManager) removePeer(id string) {
-	// Short circuit if the peer was already removed
-	peer, exists := pm.peers[id]
-	if !exists {
-		return
+// 从 downloader 和节点列表中注销节点
+func (pm *ProtocolManager) unregisterPeer(id string) {
+	pm.downloader.UnregisterPeer(id)
+	pm.peers.Unregister(id)
+}
+
+// 向 p2p server 报告节点的行为, 分数过低的节点会被断开并禁止连接
+func (pm *ProtocolManager) reportPeer(p *peer, ev p2p.PeerEvent) {
+	if pm.server != nil {
+		pm.server.ReportPeer(p.remoteID, ev)
 	}
+}
 
-	// Unregister the peer from the downloader and Ethereum peer set
-	pm.downloader.UnregisterPeer(id)
-	delete(pm.peers, id)
+// 同步出错的节点: 超时计为 EventTimeout, 其余计为 EventProtocolError
+func (pm *ProtocolManager) dropPeer(id string, err error) {
+	if p := pm.peers.Peer(id); p != nil {
+		ev := p2p.EventProtocolError
+		if downloader.IsTimeout(err) {
+			ev = p2p.EventTimeout
+		}
+		pm.reportPeer(p, ev)
+	}
+	pm.removePeer(id)
+}
 
-	// Hard disconnect at the networking layer
-	if peer != nil {
-		peer.close(p2p.DiscUselessPeer)
+// 处理插入失败的区块. 只有违反共识规则的区块才记录为 bad block, 提供者被禁止连接;
+// 时间戳过于超前可能只是时钟偏差, 按超时处理; 本地的错误与节点无关, 只断开连接
+func (pm *ProtocolManager) handleBadBlock(id string, block *types.Block, err error) {
+	peer := pm.peers.Peer(id)
+	switch {
+	case core.IsConsensusError(err):
+		remote := id
+		if peer != nil {
+			remote = peer.remoteID.String()
+			pm.reportPeer(peer, p2p.EventInvalidBlock)
+		}
+		pm.blockchain.ReportBadBlock(block, err, remote)
+
+	case err == core.ErrTooFarInFuture:
+		if peer != nil {
+			pm.reportPeer(peer, p2p.EventTimeout)
+		}
+
+	default:
+		log.Printf("Failed to insert block, number = %d, hash = %x, peer = %s, err = %v", block.NumberU64(), block.Hash(), id, err)
 	}
+	pm.removePeer(id)
 }
 
 func (pm *ProtocolManager) synchronise(peer *peer) {
@@ -120,6 +145,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		head    = pm.blockchain.CurrentHeader()
 	)
 
+	// 连接数由 p2p server 的槽位限制, 受信任的节点不占用槽位
 	log.Printf("3). do 'proton' Handshake ... \n")
 	if err := p.Handshake(pm.networkID, head.Hash(), head.Number, genesis.Hash()); err != nil {
 		log.Printf("\t\t proton handshake error: %v \n", err)
@@ -128,10 +154,10 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	log.Println("\t\t finish proton handshake.")
 
 	log.Printf("4). register proton peer ... \n")
-	if _, exists := pm.peers[p.Identifier()]; exists {
-		return fmt.Errorf("peer %q has exists.", p.Identifier())
+	if err := pm.peers.Register(p); err != nil {
+		return fmt.Errorf("register peer %q error: %v", p.Identifier(), err)
 	}
-	pm.peers[p.Identifier()] = p
+	defer pm.unregisterPeer(p.Identifier())
 	if err := pm.downloader.RegisterPeer(p.Identifier(), int(p.version), p); err != nil {
 		log.Printf("\t\t proton downloader register peer, err = %v", err)
 		return err
@@ -159,6 +185,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	case msg.Code == GetBlocksMsg:
 		var query getBlocksData
 		if err := msg.Decode(&query); err != nil {
+			pm.reportPeer(p, p2p.EventProtocolError)
 			return err
 		}
 		var (
@@ -177,6 +204,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	case msg.Code == BlocksMsg:
 		var blocks []*types.Block
 		if err := msg.Decode(&blocks); err != nil {
+			pm.reportPeer(p, p2p.EventProtocolError)
 			return fmt.Errorf("decode msg error: %v", err)
 		}
 
@@ -184,6 +212,8 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			err := pm.downloader.DeliverBlocks(p.Identifier(), blocks)
 			if err != nil {
 				log.Printf("Failed to deliver blocks, err = %v", err)
+			} else {
+				pm.reportPeer(p, p2p.EventUsefulDelivery)
 			}
 		}
 
@@ -192,3 +222,31 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	}
 	return nil
 }
+
+// NodeInfo 是 proton 协议在 admin_nodeInfo 中提供的本地节点信息
+type NodeInfo struct {
+	Network uint64      `json:"network"` // 节点所在的网络 id
+	Genesis common.Hash `json:"genesis"` // 创世区块的哈希
+	Head    common.Hash `json:"head"`    // 当前链头的哈希
+	Number  uint64      `json:"number"`  // 当前链头的编号
+}
+
+// 收集本地节点的 proton 协议信息
+func (pm *ProtocolManager) NodeInfo() *NodeInfo {
+	head := pm.blockchain.CurrentBlock()
+	return &NodeInfo{
+		Network: pm.networkID,
+		Genesis: pm.blockchain.Genesis().Hash(),
+		Head:    head.Hash(),
+		Number:  head.NumberU64(),
+	}
+}
+
+// 查询远端节点的 proton 协议信息, 节点尚未完成握手时返回 nil
+func (pm *ProtocolManager) PeerInfo(remoteID libp2p_peer.ID, version uint) *PeerInfo {
+	p := pm.peers.Peer(peerIdentifier(remoteID, uint32(version)))
+	if p == nil {
+		return nil
+	}
+	return p.Info()
+}
@@ -0,0 +1,30 @@
+package proton
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/rawdb"
+)
+
+func TestHandleBadBlock(t *testing.T) {
+	proton, blocks := newTestProton(t, 1)
+	pm, err := NewProtocolManager(proton.networkID, proton.chainDb, proton.blockchain)
+	if err != nil {
+		t.Fatalf("failed to create protocol manager: %v", err)
+	}
+
+	// 时钟偏差和本地错误不记录为 bad block
+	for _, err := range []error{core.ErrTooFarInFuture, errors.New("missing trie node")} {
+		pm.handleBadBlock("peerA", blocks[1], err)
+		if bad := rawdb.ReadAllBadBlocks(proton.chainDb); len(bad) != 0 {
+			t.Fatalf("%v recorded as bad block: %v", err, bad)
+		}
+	}
+	pm.handleBadBlock("peerA", blocks[1], core.ErrOlderBlockTime)
+	bad := rawdb.ReadAllBadBlocks(proton.chainDb)
+	if len(bad) != 1 || bad[0].Block().Hash() != blocks[1].Hash() || bad[0].Peer != "peerA" {
+		t.Fatalf("bad blocks mismatch: have %v", bad)
+	}
+}
@@ -1,6 +1,7 @@
 package proton
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
@@ -10,7 +11,6 @@ import (
 	"github.com/czh0526/perception/common"
 	"github.com/czh0526/perception/p2p"
 	"github.com/czh0526/perception/proton/core/types"
-	"github.com/libp2p/go-libp2p-core/network"
 	libp2p_peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
@@ -19,19 +19,39 @@ const (
 )
 
 type peer struct {
+	*p2p.Peer
+
 	version     uint32
 	remoteID    libp2p_peer.ID
-	rw          *p2p.ProtoRW
+	rw          p2p.MsgReadWriter // 与其他协议共享 p2p 连接, 消息码从 0 开始
 	lock        sync.RWMutex
 	head        common.Hash
 	blockNumber *big.Int
 }
 
-func newPeer(version uint, stream network.Stream, remoteID libp2p_peer.ID) *peer {
+func newPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 	return &peer{
+		Peer:     p,
 		version:  uint32(version),
-		remoteID: remoteID,
-		rw:       p2p.NewProtoRW(stream),
+		remoteID: p.ID,
+		rw:       rw,
+	}
+}
+
+// PeerInfo 是 proton 协议在 admin_peers 中提供的远端节点信息
+type PeerInfo struct {
+	Version uint32      `json:"version"` // 协商使用的 proton 协议版本
+	Head    common.Hash `json:"head"`    // 对端最新区块的哈希
+	Number  *big.Int    `json:"number"`  // 对端最新区块的编号
+}
+
+// 收集对端的 proton 协议信息
+func (p *peer) Info() *PeerInfo {
+	hash, number := p.Head()
+	return &PeerInfo{
+		Version: p.version,
+		Head:    hash,
+		Number:  number,
 	}
 }
 
@@ -105,8 +125,13 @@ func (p *peer) readStatus(network uint64, status *statusData, genesis common.Has
 	return nil
 }
 
+// 断开 p2p 连接, 连接上的其他协议也随之结束
 func (p *peer) close(err error) {
-	p.rw.Close(err)
+	reason, ok := err.(p2p.DiscReason)
+	if !ok {
+		reason = p2p.DiscSubprotocolError
+	}
+	p.Disconnect(reason)
 }
 
 func (p *peer) Head() (hash common.Hash, number *big.Int) {
@@ -129,3 +154,68 @@ func (p *peer) SendBlocks(blocks []*types.Block) error {
 func (p *peer) RequestNodeData(hashes []common.Hash) error {
 	return p2p.Send(p.rw, GetNodeDataMsg, hashes)
 }
+
+var errAlreadyRegistered = errors.New("peer is already registered")
+
+// peerSet 是已经完成 proton 握手的节点集合, 可以被多个 goroutine 同时访问
+type peerSet struct {
+	peers map[string]*peer
+	lock  sync.RWMutex
+}
+
+func newPeerSet() *peerSet {
+	return &peerSet{
+		peers: make(map[string]*peer),
+	}
+}
+
+// 加入节点, 节点已经存在时返回错误
+func (ps *peerSet) Register(p *peer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if _, exists := ps.peers[p.Identifier()]; exists {
+		return errAlreadyRegistered
+	}
+	ps.peers[p.Identifier()] = p
+	return nil
+}
+
+func (ps *peerSet) Unregister(id string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	delete(ps.peers, id)
+}
+
+// 返回 id 对应的节点, 不存在时返回 nil
+func (ps *peerSet) Peer(id string) *peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return ps.peers[id]
+}
+
+func (ps *peerSet) Len() int {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return len(ps.peers)
+}
+
+// 返回区块高度最高的节点
+func (ps *peerSet) BestPeer() *peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	var (
+		bestPeer *peer
+		bestNum  *big.Int = big.NewInt(0)
+	)
+	for _, p := range ps.peers {
+		if _, num := p.Head(); bestNum.Cmp(big.NewInt(0)) == 0 || num.Cmp(bestNum) > 0 {
+			bestPeer, bestNum = p, num
+		}
+	}
+	return bestPeer
+}
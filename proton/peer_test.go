@@ -0,0 +1,64 @@
+package proton
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/czh0526/perception/p2p"
+	libp2p_peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func newTestPeer(id string, number int64) *peer {
+	p := newPeer(Protocol_V1, &p2p.Peer{ID: libp2p_peer.ID(id)}, nil)
+	p.blockNumber = big.NewInt(number)
+	return p
+}
+
+func TestPeerSet(t *testing.T) {
+	ps := newPeerSet()
+	low, high := newTestPeer("low", 1), newTestPeer("high", 5)
+	if err := ps.Register(low); err != nil {
+		t.Fatalf("failed to register peer: %v", err)
+	}
+	if err := ps.Register(high); err != nil {
+		t.Fatalf("failed to register peer: %v", err)
+	}
+	if err := ps.Register(newTestPeer("low", 3)); err != errAlreadyRegistered {
+		t.Errorf("error mismatch: have %v, want %v", err, errAlreadyRegistered)
+	}
+	if best := ps.BestPeer(); best != high {
+		t.Errorf("best peer mismatch: have %v", best)
+	}
+	ps.Unregister(high.Identifier())
+	if ps.Len() != 1 || ps.Peer(high.Identifier()) != nil || ps.BestPeer() != low {
+		t.Errorf("peer not unregistered")
+	}
+}
+
+// admin_peers 在节点连接和断开的同时查询节点信息
+func TestPeerInfoConcurrentChurn(t *testing.T) {
+	pm := &ProtocolManager{peers: newPeerSet()}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p := newTestPeer(fmt.Sprintf("peer-%d-%d", i, j), int64(j))
+				pm.peers.Register(p)
+				pm.peers.Unregister(p.Identifier())
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				pm.PeerInfo(libp2p_peer.ID(fmt.Sprintf("peer-%d-%d", i, j)), Protocol_V1)
+				pm.peers.BestPeer()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,99 @@
+package proton
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/db/memorydb"
+	"github.com/czh0526/perception/proton/core/state"
+	"github.com/czh0526/perception/proton/crypto"
+	"github.com/czh0526/perception/proton/trie"
+	"github.com/czh0526/perception/rlp"
+)
+
+var (
+	// 空 trie 的根, 没有存储项的账户的 storageHash
+	emptyStorageRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+	// 空代码的哈希
+	emptyCodeHash = crypto.Keccak256Hash(nil)
+)
+
+// VerifyProof 对照区块头的 stateRoot 校验 proton_getProof 的返回值.
+// 账户的余额, nonce, codeHash 和 storageHash 必须与 accountProof 证明的账户一致,
+// 每个存储项的值必须与其 proof 证明的值一致. 账户不存在时, 这些字段必须为空值.
+func VerifyProof(stateRoot common.Hash, result *AccountResult) error {
+	if result == nil {
+		return errors.New("nil proof result")
+	}
+	value, err := verifyProof(stateRoot, result.Address.Bytes(), result.AccountProof)
+	if err != nil {
+		return fmt.Errorf("invalid account proof: %v", err)
+	}
+
+	// 账户不存在时, proof 证明的是 key 的缺失
+	account := state.Account{Balance: new(big.Int), Root: emptyStorageRoot, CodeHash: emptyCodeHash.Bytes()}
+	if value != nil {
+		if err := rlp.DecodeBytes(value, &account); err != nil {
+			return fmt.Errorf("invalid account encoding: %v", err)
+		}
+	}
+	if result.Balance == nil || result.Balance.ToInt().Cmp(account.Balance) != 0 {
+		return fmt.Errorf("balance mismatch: have %v, want %v", result.Balance, account.Balance)
+	}
+	if uint64(result.Nonce) != account.Nonce {
+		return fmt.Errorf("nonce mismatch: have %d, want %d", result.Nonce, account.Nonce)
+	}
+	if result.StorageHash != account.Root {
+		return fmt.Errorf("storage hash mismatch: have %x, want %x", result.StorageHash, account.Root)
+	}
+	if value != nil && !bytes.Equal(result.CodeHash.Bytes(), account.CodeHash) {
+		return fmt.Errorf("code hash mismatch: have %x, want %x", result.CodeHash, account.CodeHash)
+	}
+
+	for _, sr := range result.StorageProof {
+		if sr.Value == nil {
+			return fmt.Errorf("storage %s: missing value", sr.Key)
+		}
+		// 空的 storage trie 没有任何节点, 所有存储项都为 0
+		if account.Root == emptyStorageRoot {
+			if sr.Value.ToInt().Sign() != 0 {
+				return fmt.Errorf("storage %s: non-zero value in empty storage", sr.Key)
+			}
+			continue
+		}
+		enc, err := verifyProof(account.Root, common.HexToHash(sr.Key).Bytes(), sr.Proof)
+		if err != nil {
+			return fmt.Errorf("storage %s: invalid proof: %v", sr.Key, err)
+		}
+		want := new(big.Int)
+		if enc != nil {
+			_, content, _, err := rlp.Split(enc)
+			if err != nil {
+				return fmt.Errorf("storage %s: invalid value encoding: %v", sr.Key, err)
+			}
+			want.SetBytes(content)
+		}
+		if sr.Value.ToInt().Cmp(want) != 0 {
+			return fmt.Errorf("storage %s: value mismatch: have %v, want %v", sr.Key, sr.Value, want)
+		}
+	}
+	return nil
+}
+
+// 以 keccak256(key) 为路径校验 proof, 返回 proof 证明的值, key 不存在时返回 nil
+func verifyProof(root common.Hash, key []byte, proof []string) ([]byte, error) {
+	db := memorydb.New()
+	for _, node := range proof {
+		enc, err := hexutil.Decode(node)
+		if err != nil {
+			return nil, err
+		}
+		db.Put(crypto.Keccak256(enc), enc)
+	}
+	value, _, err := trie.VerifyProof(root, crypto.Keccak256(key), db)
+	return value, err
+}
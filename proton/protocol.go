@@ -1,12 +1,9 @@
 package proton
 
 import (
-	"fmt"
 	"math/big"
 
 	"github.com/czh0526/perception/common"
-	"github.com/libp2p/go-libp2p-core/network"
-	"github.com/libp2p/go-libp2p-core/protocol"
 )
 
 const (
@@ -14,19 +11,23 @@ const (
 	ProtocolName      = "proton"
 )
 
-var ProtocolID = protocol.ID(fmt.Sprintf("/%s/%d", ProtocolName, Protocol_V1))
-var ProtocolVersions = make(map[uint]network.StreamHandler)
+// 支持的协议版本, 按照优先级从高到低排列. 与对端握手时选择双方都支持的最高版本.
+var ProtocolVersions = []uint{Protocol_V1}
+
+// 每个协议版本使用的消息码数量
+var ProtocolLengths = map[uint]uint64{Protocol_V1: 7}
 
 const protocolMaxMsgSize = 10 * 1024 * 1024
 
+// 协议内的消息码, 在连接上传输时由 p2p 加上协议的 offset
 const (
-	StatusMsg         = 0x10
-	NewBlockHashesMsg = 0x11
-	TxMsg             = 0x12
-	GetBlocksMsg      = 0x13
-	BlocksMsg         = 0x14
-	GetNodeDataMsg    = 0x15
-	NodeDataMsg       = 0x16
+	StatusMsg         = 0x00
+	NewBlockHashesMsg = 0x01
+	TxMsg             = 0x02
+	GetBlocksMsg      = 0x03
+	BlocksMsg         = 0x04
+	GetNodeDataMsg    = 0x05
+	NodeDataMsg       = 0x06
 )
 
 type statusData struct {
@@ -1,27 +1,26 @@
 package proton
 
 import (
-	"context"
 	"fmt"
-	"log"
 	"sync"
 
 	"github.com/czh0526/perception/node"
 	"github.com/czh0526/perception/p2p"
 	"github.com/czh0526/perception/proton/chaindb"
 	"github.com/czh0526/perception/proton/core"
-	"github.com/libp2p/go-libp2p-core/host"
-	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/czh0526/perception/proton/filters"
+	"github.com/czh0526/perception/rpc"
 	libp2p_peer "github.com/libp2p/go-libp2p-core/peer"
-	"github.com/libp2p/go-libp2p-core/protocol"
 )
 
 type Proton struct {
 	config *Config
 
 	networkID       uint64
+	chainDb         chaindb.Database
+	blockchain      *core.BlockChain
+	txPool          *core.TxPool
 	protocolManager *ProtocolManager
-	host            host.Host
 
 	lock sync.RWMutex
 }
@@ -52,6 +51,9 @@ func New(ctx *node.ServiceContext, conf *Config) (*Proton, error) {
 	proton := &Proton{
 		config:          conf,
 		networkID:       networkID,
+		chainDb:         chainDb,
+		blockchain:      blockchain,
+		txPool:          core.NewTxPool(blockchain),
 		protocolManager: protocolManager,
 	}
 
@@ -60,66 +62,84 @@ func New(ctx *node.ServiceContext, conf *Config) (*Proton, error) {
 
 func (self *Proton) Start(p2pServer *p2p.Server) error {
 	<-p2pServer.Inited
-	self.host = p2pServer.Host
 
-	var protoStr string
-	protoStr = fmt.Sprintf("/%s/%d", ProtocolName, Protocol_V1)
-
-	self.host.SetStreamHandler(protocol.ID(protoStr), self.streamHandlerV1)
-	log.Printf("\t set stream handler for '%s' \n", protoStr)
-
-	self.protocolManager.Start(30)
+	self.protocolManager.server = p2pServer
+	self.protocolManager.Start()
 	return nil
 }
 
 func (self *Proton) Stop() error {
+	self.txPool.Stop()
+	self.blockchain.Stop()
 	fmt.Println("Service Proton stopped.")
 	return nil
 }
 
+func (self *Proton) BlockChain() *core.BlockChain { return self.blockchain }
+func (self *Proton) TxPool() *core.TxPool         { return self.txPool }
+func (self *Proton) ChainDb() chaindb.Database    { return self.chainDb }
+
 func (self *Proton) Protocols() []p2p.Protocol {
 	protos := make([]p2p.Protocol, 0, len(ProtocolVersions))
-	protos = append(protos, self.makeProtocol(Protocol_V1))
+	for _, version := range ProtocolVersions {
+		protos = append(protos, self.makeProtocol(version))
+	}
 
 	return protos
 }
 
+// Proton 提供的 RPC 服务
+func (self *Proton) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "proton",
+			Version:   "1.0",
+			Service:   NewPublicBlockChainAPI(self),
+			Public:    true,
+		},
+		{
+			Namespace: "proton",
+			Version:   "1.0",
+			Service:   NewPublicTransactionPoolAPI(self),
+			Public:    true,
+		},
+		{
+			Namespace: "proton",
+			Version:   "1.0",
+			Service:   filters.NewPublicFilterAPI(&ProtonAPIBackend{self}),
+			Public:    true,
+		},
+		{
+			Namespace: "debug",
+			Version:   "1.0",
+			Service:   NewPublicDebugAPI(self),
+			Public:    true,
+		},
+		{
+			Namespace: "debug",
+			Version:   "1.0",
+			Service:   NewPrivateDebugAPI(self),
+		},
+	}
+}
+
 func (self *Proton) makeProtocol(version uint) p2p.Protocol {
 	return p2p.Protocol{
-		Name:    ProtocolName,
-		Version: version,
-		Run: func(remoteID libp2p_peer.ID, initial bool) error {
-			var (
-				p      *peer
-				exists bool
-			)
-			peerIdent := peerIdentifier(remoteID, uint32(version))
-			// 已经存在额连接，不处理
-			if p, exists = self.protocolManager.peers[peerIdent]; exists {
-				return fmt.Errorf("protocolManager has a peer <%s> conn before ...", peerIdent)
-			}
-			// 应该被动等待的链接，不处理
-			if !initial {
-				return nil
-			}
-
-			stream, err := self.host.NewStream(context.Background(), remoteID, ProtocolID)
-			if err != nil {
-				log.Printf("libp2p NewStream(%v) error: %v \n", ProtocolID, err)
-				return err
+		Name:       ProtocolName,
+		Version:    version,
+		Length:     ProtocolLengths[version],
+		MaxMsgSize: protocolMaxMsgSize,
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			return self.protocolManager.handle(newPeer(version, p, rw))
+		},
+		NodeInfo: func() interface{} {
+			return self.protocolManager.NodeInfo()
+		},
+		PeerInfo: func(id libp2p_peer.ID) interface{} {
+			if info := self.protocolManager.PeerInfo(id, version); info != nil {
+				return info
 			}
-
-			log.Printf("\t\t initial new stream(%v) to %v \n", ProtocolID, remoteID.String())
-			p = newPeer(version, stream, remoteID)
-			return self.protocolManager.handle(p)
+			return nil
 		},
 	}
 }
-
-func (self *Proton) streamHandlerV1(stream network.Stream) {
-	log.Printf("\t\t accept new stream from %v \n", stream.Conn().RemotePeer())
-	remoteID := stream.Conn().RemotePeer()
-	p := newPeer(Protocol_V1, stream, remoteID)
-	//self.protocolManager.addpeer <- p
-	go self.protocolManager.handle(p)
-}
@@ -0,0 +1,201 @@
+// Package protonclient 是 proton RPC API 的 Go 客户端, 应答被解码为 core/types 中的类型
+package protonclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/common/hexutil"
+	"github.com/czh0526/perception/proton/core/types"
+	"github.com/czh0526/perception/rlp"
+	"github.com/czh0526/perception/rpc"
+)
+
+// ErrNotFound 表示请求的区块, 区块头或者收据不存在
+var ErrNotFound = errors.New("not found")
+
+// Client 通过 RPC 访问 proton API
+type Client struct {
+	c *rpc.Client
+}
+
+// Dial 连接到 rawurl 指定的节点, 支持 http, ws 和 IPC
+func Dial(rawurl string) (*Client, error) {
+	return DialContext(context.Background(), rawurl)
+}
+
+func DialContext(ctx context.Context, rawurl string) (*Client, error) {
+	c, err := rpc.DialContext(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(c), nil
+}
+
+// NewClient 基于已有的 RPC client 创建 Client
+func NewClient(c *rpc.Client) *Client {
+	return &Client{c}
+}
+
+func (pc *Client) Close() {
+	pc.c.Close()
+}
+
+// ChainID 返回节点的链 ID
+func (pc *Client) ChainID(ctx context.Context) (*big.Int, error) {
+	var result hexutil.Uint64
+	if err := pc.c.CallContext(ctx, &result, "proton_chainId"); err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetUint64(uint64(result)), nil
+}
+
+// BlockNumber 返回链头的区块号
+func (pc *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	var result hexutil.Uint64
+	err := pc.c.CallContext(ctx, &result, "proton_blockNumber")
+	return uint64(result), err
+}
+
+// BlockByHash 返回指定哈希的完整区块
+func (pc *Client) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return pc.getBlock(ctx, "proton_getBlockByHash", hash, true)
+}
+
+// BlockByNumber 返回指定高度的完整区块, number 为 nil 时返回链头区块
+func (pc *Client) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return pc.getBlock(ctx, "proton_getBlockByNumber", toBlockNumArg(number), true)
+}
+
+// rpcBlock 是区块在 RPC 应答中的格式, 区块头的字段与交易列表平铺在一起
+type rpcBlock struct {
+	Hash         common.Hash      `json:"hash"`
+	Transactions []rpcTransaction `json:"transactions"`
+}
+
+type rpcTransaction struct {
+	Hash common.Hash `json:"hash"`
+	Data string      `json:"data"`
+}
+
+func (pc *Client) getBlock(ctx context.Context, method string, args ...interface{}) (*types.Block, error) {
+	var raw json.RawMessage
+	if err := pc.c.CallContext(ctx, &raw, method, args...); err != nil {
+		return nil, err
+	} else if isNull(raw) {
+		return nil, ErrNotFound
+	}
+	var head *types.Header
+	var body rpcBlock
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	if head.Hash() != body.Hash {
+		return nil, fmt.Errorf("server returned block with wrong hash %x, computed %x", body.Hash, head.Hash())
+	}
+	txs := make([]*types.Transaction, len(body.Transactions))
+	for i, rtx := range body.Transactions {
+		txs[i] = types.NewTransaction(rtx.Data)
+		if txs[i].Hash() != rtx.Hash {
+			return nil, fmt.Errorf("server returned transaction %d with wrong hash %x, computed %x", i, rtx.Hash, txs[i].Hash())
+		}
+	}
+	if len(txs) > 0 && types.DeriveSha(types.Transactions(txs)) != head.TxHash {
+		return nil, fmt.Errorf("server returned transactions not matching transactionsRoot %x", head.TxHash)
+	}
+	return types.NewBlockWithHeader(head).WithBody(txs), nil
+}
+
+// HeaderByHash 返回指定哈希的区块头
+func (pc *Client) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return pc.getHeader(ctx, "proton_getHeaderByHash", hash)
+}
+
+// HeaderByNumber 返回指定高度的区块头, number 为 nil 时返回链头
+func (pc *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return pc.getHeader(ctx, "proton_getHeaderByNumber", toBlockNumArg(number))
+}
+
+func (pc *Client) getHeader(ctx context.Context, method string, args ...interface{}) (*types.Header, error) {
+	var raw json.RawMessage
+	if err := pc.c.CallContext(ctx, &raw, method, args...); err != nil {
+		return nil, err
+	} else if isNull(raw) {
+		return nil, ErrNotFound
+	}
+	var head *types.Header
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+// BalanceAt 返回账户在指定区块状态下的余额, blockNumber 为 nil 时使用链头
+func (pc *Client) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	var result hexutil.Big
+	err := pc.c.CallContext(ctx, &result, "proton_getBalance", account, toBlockNumArg(blockNumber))
+	return (*big.Int)(&result), err
+}
+
+// NonceAt 返回账户在指定区块状态下的 nonce, blockNumber 为 nil 时使用链头
+func (pc *Client) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	var result hexutil.Uint64
+	err := pc.c.CallContext(ctx, &result, "proton_getTransactionCount", account, toBlockNumArg(blockNumber))
+	return uint64(result), err
+}
+
+// SendTransaction 将交易 rlp 编码后提交到节点的交易池
+func (pc *Client) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return err
+	}
+	return pc.c.CallContext(ctx, nil, "proton_sendRawTransaction", hexutil.Bytes(data))
+}
+
+// Receipt 是已打包交易的收据
+type Receipt struct {
+	TxHash           common.Hash    `json:"transactionHash"`
+	TransactionIndex hexutil.Uint64 `json:"transactionIndex"`
+	BlockHash        common.Hash    `json:"blockHash"`
+	BlockNumber      hexutil.Uint64 `json:"blockNumber"`
+	Status           hexutil.Uint   `json:"status"`
+}
+
+// TransactionReceipt 返回交易的收据, 交易尚未打包时返回 ErrNotFound
+func (pc *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*Receipt, error) {
+	var raw json.RawMessage
+	if err := pc.c.CallContext(ctx, &raw, "proton_getTransactionReceipt", txHash); err != nil {
+		return nil, err
+	} else if isNull(raw) {
+		return nil, ErrNotFound
+	}
+	var receipt *Receipt
+	if err := json.Unmarshal(raw, &receipt); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// SubscribeNewHead 订阅链头的变化, 新的区块头被写入 ch. 只有 WebSocket, IPC 和进程内连接支持订阅.
+func (pc *Client) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (*rpc.ClientSubscription, error) {
+	return pc.c.Subscribe(ctx, "proton", ch, "newHeads")
+}
+
+func toBlockNumArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	return hexutil.EncodeBig(number)
+}
+
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
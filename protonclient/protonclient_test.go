@@ -0,0 +1,169 @@
+package protonclient
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/czh0526/perception/common"
+	"github.com/czh0526/perception/node"
+	"github.com/czh0526/perception/p2p"
+	"github.com/czh0526/perception/proton"
+	"github.com/czh0526/perception/proton/core"
+	"github.com/czh0526/perception/proton/core/types"
+)
+
+var testAddr = common.BytesToAddress([]byte{1})
+
+// newTestClient 启动一个运行 proton 服务的节点, 通过进程内连接访问真实的 proton API.
+// 链上包含 genesis 和一个带两笔交易的区块.
+func newTestClient(t *testing.T) (*Client, *proton.Proton, []*types.Block) {
+	datadir, err := ioutil.TempDir("", "protonclient-test")
+	if err != nil {
+		t.Fatalf("failed to create datadir: %v", err)
+	}
+	stack, err := node.New(&node.Config{
+		DataDir: datadir,
+		P2P:     p2p.Config{ListenAddr: "/ip4/127.0.0.1/tcp/0", NoDiscovery: true, MaxPeers: 1},
+	})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+
+	// 预先写入区块, proton 启动时从数据库中加载
+	db, err := stack.OpenDatabase("chaindata", 0, 0, "")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	gspec := &core.Genesis{Alloc: core.GenesisAlloc{
+		testAddr: {Balance: big.NewInt(1000), Nonce: 3},
+	}}
+	bc, blocks, err := core.GenerateBlockChain(db, gspec, 1, func(i int, b *core.BlockGen) {
+		b.AddTx(types.NewTransaction("a"))
+		b.AddTx(types.NewTransaction("b"))
+	})
+	if err != nil {
+		t.Fatalf("failed to generate chain: %v", err)
+	}
+	bc.Stop()
+	db.Close()
+
+	var backend *proton.Proton
+	stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		backend, err = proton.New(ctx, &proton.Config{NetworkId: 7, DatabaseCache: 16, DatabaseHandles: 16})
+		return backend, err
+	})
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	rpcClient, err := stack.Attach()
+	if err != nil {
+		t.Fatalf("failed to attach to node: %v", err)
+	}
+	client := NewClient(rpcClient)
+	t.Cleanup(func() {
+		client.Close()
+		stack.Stop()
+		os.RemoveAll(datadir)
+	})
+	return client, backend, blocks
+}
+
+func TestBlocksAndHeaders(t *testing.T) {
+	client, _, blocks := newTestClient(t)
+	ctx := context.Background()
+
+	if id, err := client.ChainID(ctx); err != nil || id.Uint64() != 7 {
+		t.Errorf("chain id mismatch: have %v, %v", id, err)
+	}
+	if num, err := client.BlockNumber(ctx); err != nil || num != 1 {
+		t.Errorf("block number mismatch: have %d, %v", num, err)
+	}
+	head, err := client.BlockByNumber(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to get head block: %v", err)
+	}
+	want := blocks[1]
+	if head.Hash() != want.Hash() || len(head.Transactions()) != 2 || head.Transactions()[1].Hash() != want.Transactions()[1].Hash() {
+		t.Errorf("head block mismatch: have %x", head.Hash())
+	}
+	block, err := client.BlockByHash(ctx, blocks[0].Hash())
+	if err != nil || block.NumberU64() != 0 || len(block.Transactions()) != 0 {
+		t.Errorf("genesis mismatch: have %v, %v", block, err)
+	}
+	if _, err := client.BlockByNumber(ctx, big.NewInt(5)); err != ErrNotFound {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrNotFound)
+	}
+
+	header, err := client.HeaderByHash(ctx, want.Hash())
+	if err != nil || header.Hash() != want.Hash() {
+		t.Errorf("header mismatch: have %v, %v", header, err)
+	}
+	if _, err := client.HeaderByHash(ctx, common.Hash{1}); err != ErrNotFound {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestStateAndTransactions(t *testing.T) {
+	client, backend, blocks := newTestClient(t)
+	ctx := context.Background()
+
+	if balance, err := client.BalanceAt(ctx, testAddr, big.NewInt(1)); err != nil || balance.Int64() != 1000 {
+		t.Errorf("balance mismatch: have %v, %v", balance, err)
+	}
+	if nonce, err := client.NonceAt(ctx, testAddr, nil); err != nil || nonce != 3 {
+		t.Errorf("nonce mismatch: have %v, %v", nonce, err)
+	}
+
+	tx := types.NewTransaction("c")
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	if pooled := backend.TxPool().Get(tx.Hash()); pooled == nil {
+		t.Errorf("sent transaction missing from the pool")
+	}
+
+	included := blocks[1].Transactions()[0]
+	receipt, err := client.TransactionReceipt(ctx, included.Hash())
+	if err != nil {
+		t.Fatalf("failed to get receipt: %v", err)
+	}
+	if receipt.BlockHash != blocks[1].Hash() || receipt.BlockNumber != 1 || receipt.Status != 1 {
+		t.Errorf("receipt mismatch: have %+v", receipt)
+	}
+	if _, err := client.TransactionReceipt(ctx, tx.Hash()); err != ErrNotFound {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestSubscribeNewHead(t *testing.T) {
+	client, backend, blocks := newTestClient(t)
+
+	ch := make(chan *types.Header)
+	sub, err := client.SubscribeNewHead(context.Background(), ch)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	// 订阅之后插入的区块才会被通知, 新区块的时间戳不能晚于当前时间
+	next := core.GenerateChain(blocks[1], backend.ChainDb(), 1, nil)
+	if _, err := backend.BlockChain().InsertChain(next); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for _, block := range next {
+		select {
+		case header := <-ch:
+			if header.Hash() != block.Hash() {
+				t.Errorf("header mismatch: have %x, want %x", header.Hash(), block.Hash())
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription failed: %v", err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for header")
+		}
+	}
+}
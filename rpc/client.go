@@ -0,0 +1,434 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrClientQuit                = errors.New("client is closed")
+	ErrNoResult                  = errors.New("no result in JSON-RPC response")
+	ErrSubscriptionQueueOverflow = errors.New("subscription queue overflow")
+)
+
+const (
+	// 连接建立和取消订阅的超时时间
+	defaultDialTimeout = 10 * time.Second
+	unsubscribeTimeout = 10 * time.Second
+
+	// 订阅中尚未被读取的通知的最大数量, 超过之后订阅会被取消
+	maxClientSubscriptionBuffer = 20000
+)
+
+// Client 是 JSON-RPC 客户端, 支持 HTTP, WebSocket, IPC 和进程内四种连接.
+// 只有 WebSocket, IPC 和进程内连接支持订阅.
+type Client struct {
+	idCounter uint32
+
+	// HTTP 连接, 每个请求都是一个独立的 POST
+	httpURL    string
+	httpClient *http.Client
+
+	// 流式连接, 由 read 循环分发应答和通知
+	conn     ServerCodec
+	mu       sync.Mutex
+	respWait map[string]*requestOp
+	subs     map[string]*ClientSubscription
+	readErr  error
+	didQuit  chan struct{}
+}
+
+// requestOp 是等待应答的请求, 订阅请求在应答到达时就注册订阅, 避免丢失紧随其后的通知
+type requestOp struct {
+	resp chan *jsonrpcMessage
+	sub  *ClientSubscription
+}
+
+// Dial 根据 rawurl 的 scheme 选择连接方式: http(s) 和 ws(s) 分别连接 HTTP 和 WebSocket, 没有 scheme 时连接 IPC
+func Dial(rawurl string) (*Client, error) {
+	return DialContext(context.Background(), rawurl)
+}
+
+func DialContext(ctx context.Context, rawurl string) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return DialHTTP(rawurl)
+	case "ws", "wss":
+		return DialWebsocket(ctx, rawurl, "")
+	case "":
+		return DialIPC(ctx, rawurl)
+	default:
+		return nil, fmt.Errorf("no known transport for URL scheme %q", u.Scheme)
+	}
+}
+
+// DialHTTP 创建连接 HTTP-RPC 服务的客户端, 不会立即建立连接
+func DialHTTP(endpoint string) (*Client, error) {
+	return &Client{
+		httpURL:    endpoint,
+		httpClient: new(http.Client),
+	}, nil
+}
+
+// DialWebsocket 连接 WebSocket-RPC 服务, origin 为空时不设置 Origin 头
+func DialWebsocket(ctx context.Context, endpoint, origin string) (*Client, error) {
+	header := make(http.Header)
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: defaultDialTimeout}
+	conn, _, err := dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(NewFuncCodec(conn, conn.WriteJSON, conn.ReadJSON)), nil
+}
+
+// DialIPC 连接 IPC-RPC 服务
+func DialIPC(ctx context.Context, endpoint string) (*Client, error) {
+	conn, err := newIPCConnection(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(NewCodec(conn)), nil
+}
+
+// DialInProc 创建直接连接 srv 的客户端, 不经过网络
+func DialInProc(srv *Server) *Client {
+	p1, p2 := net.Pipe()
+	go srv.ServeCodec(NewCodec(p1))
+	return newClient(NewCodec(p2))
+}
+
+func newClient(conn ServerCodec) *Client {
+	c := &Client{
+		conn:     conn,
+		respWait: make(map[string]*requestOp),
+		subs:     make(map[string]*ClientSubscription),
+		didQuit:  make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+func (c *Client) isHTTP() bool {
+	return c.conn == nil
+}
+
+// Close 关闭连接, 正在等待应答的请求和全部订阅都会结束
+func (c *Client) Close() {
+	if c.isHTTP() {
+		return
+	}
+	c.conn.close()
+	<-c.didQuit
+}
+
+func (c *Client) nextID() json.RawMessage {
+	id := atomic.AddUint32(&c.idCounter, 1)
+	return strconv.AppendUint(nil, uint64(id), 10)
+}
+
+func (c *Client) newMessage(method string, args ...interface{}) (*jsonrpcMessage, error) {
+	msg := &jsonrpcMessage{Version: vsn, ID: c.nextID(), Method: method}
+	if args == nil {
+		args = []interface{}{}
+	}
+	params, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	msg.Params = params
+	return msg, nil
+}
+
+// Call 调用 method, 并将应答解码到 result 中, result 为 nil 时丢弃应答
+func (c *Client) Call(result interface{}, method string, args ...interface{}) error {
+	return c.CallContext(context.Background(), result, method, args...)
+}
+
+// CallContext 与 Call 相同, ctx 结束时停止等待应答
+func (c *Client) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	msg, err := c.newMessage(method, args...)
+	if err != nil {
+		return err
+	}
+	var resp *jsonrpcMessage
+	if c.isHTTP() {
+		resp, err = c.sendHTTP(ctx, msg)
+	} else {
+		resp, err = c.send(ctx, msg, nil)
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.Error != nil:
+		return resp.Error
+	case len(resp.Result) == 0:
+		return ErrNoResult
+	case result == nil:
+		return nil
+	default:
+		return json.Unmarshal(resp.Result, result)
+	}
+}
+
+// SupportedModules 返回服务端开放的 RPC 模块以及版本
+func (c *Client) SupportedModules() (map[string]string, error) {
+	var modules map[string]string
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+	defer cancel()
+	err := c.CallContext(ctx, &modules, MetadataApi+"_modules")
+	return modules, err
+}
+
+func (c *Client) sendHTTP(ctx context.Context, msg *jsonrpcMessage) (*jsonrpcMessage, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.httpURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		text, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(text))
+	}
+	var respmsg jsonrpcMessage
+	if err := json.NewDecoder(resp.Body).Decode(&respmsg); err != nil {
+		return nil, err
+	}
+	return &respmsg, nil
+}
+
+// 在流式连接上发送请求并等待应答
+func (c *Client) send(ctx context.Context, msg *jsonrpcMessage, sub *ClientSubscription) (*jsonrpcMessage, error) {
+	op := &requestOp{resp: make(chan *jsonrpcMessage, 1), sub: sub}
+	c.mu.Lock()
+	if c.readErr != nil {
+		c.mu.Unlock()
+		return nil, ErrClientQuit
+	}
+	c.respWait[string(msg.ID)] = op
+	c.mu.Unlock()
+
+	removeOp := func() {
+		c.mu.Lock()
+		delete(c.respWait, string(msg.ID))
+		c.mu.Unlock()
+	}
+	if err := c.conn.writeJSON(ctx, msg); err != nil {
+		removeOp()
+		return nil, err
+	}
+	select {
+	case resp := <-op.resp:
+		return resp, nil
+	case <-ctx.Done():
+		removeOp()
+		return nil, ctx.Err()
+	case <-c.didQuit:
+		return nil, ErrClientQuit
+	}
+}
+
+// read 循环读取连接上的消息, 将应答交给等待的请求, 将通知交给对应的订阅
+func (c *Client) read() {
+	for {
+		msgs, _, err := c.conn.readBatch()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		for _, msg := range msgs {
+			c.dispatch(msg)
+		}
+	}
+}
+
+func (c *Client) dispatch(msg *jsonrpcMessage) {
+	if msg.isNotification() {
+		var result subscriptionResult
+		if err := json.Unmarshal(msg.Params, &result); err != nil {
+			return
+		}
+		c.mu.Lock()
+		sub := c.subs[result.ID]
+		c.mu.Unlock()
+		if sub != nil {
+			sub.deliver(result.Result)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	op := c.respWait[string(msg.ID)]
+	delete(c.respWait, string(msg.ID))
+	if op != nil && op.sub != nil && msg.Error == nil {
+		if err := json.Unmarshal(msg.Result, &op.sub.subid); err == nil {
+			c.subs[op.sub.subid] = op.sub
+		}
+	}
+	c.mu.Unlock()
+	if op != nil {
+		op.resp <- msg
+	}
+}
+
+// 连接断开, 结束全部订阅
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	c.readErr = err
+	subs := c.subs
+	c.subs = make(map[string]*ClientSubscription)
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.quitWithError(err, false)
+	}
+	close(c.didQuit)
+}
+
+// Subscribe 调用 namespace_subscribe 创建订阅, 通知被解码后依次写入 channel.
+// channel 必须是可写的 channel, 其元素类型与通知的内容一致.
+func (c *Client) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (*ClientSubscription, error) {
+	chanVal := reflect.ValueOf(channel)
+	if chanVal.Kind() != reflect.Chan || chanVal.Type().ChanDir()&reflect.SendDir == 0 {
+		panic("first argument to Subscribe must be a writable channel")
+	}
+	if chanVal.IsNil() {
+		panic("channel given to Subscribe must not be nil")
+	}
+	if c.isHTTP() {
+		return nil, ErrNotificationsUnsupported
+	}
+
+	msg, err := c.newMessage(namespace+subscribeMethodSuffix, args...)
+	if err != nil {
+		return nil, err
+	}
+	sub := newClientSubscription(c, namespace, chanVal)
+	resp, err := c.send(ctx, msg, sub)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	go sub.forward()
+	return sub, nil
+}
+
+// ClientSubscription 是客户端的订阅, 通过 Err 获知订阅的结束
+type ClientSubscription struct {
+	client    *Client
+	namespace string
+	subid     string
+	etype     reflect.Type
+	channel   reflect.Value
+
+	in       chan json.RawMessage
+	quitOnce sync.Once
+	quit     chan struct{}
+	err      chan error
+}
+
+func newClientSubscription(c *Client, namespace string, channel reflect.Value) *ClientSubscription {
+	return &ClientSubscription{
+		client:    c,
+		namespace: namespace,
+		etype:     channel.Type().Elem(),
+		channel:   channel,
+		in:        make(chan json.RawMessage, maxClientSubscriptionBuffer),
+		quit:      make(chan struct{}),
+		err:       make(chan error, 1),
+	}
+}
+
+// Err 返回的 channel 在订阅结束时关闭, 连接断开等异常结束时先写入错误
+func (sub *ClientSubscription) Err() <-chan error {
+	return sub.err
+}
+
+// Unsubscribe 取消订阅, 不再向 channel 写入通知
+func (sub *ClientSubscription) Unsubscribe() {
+	sub.quitWithError(nil, true)
+}
+
+func (sub *ClientSubscription) quitWithError(err error, unsubscribeServer bool) {
+	sub.quitOnce.Do(func() {
+		close(sub.quit)
+		sub.client.mu.Lock()
+		delete(sub.client.subs, sub.subid)
+		sub.client.mu.Unlock()
+
+		if unsubscribeServer {
+			ctx, cancel := context.WithTimeout(context.Background(), unsubscribeTimeout)
+			sub.client.CallContext(ctx, nil, sub.namespace+unsubscribeMethodSuffix, sub.subid)
+			cancel()
+		}
+		if err != nil {
+			sub.err <- err
+		}
+		close(sub.err)
+	})
+}
+
+// deliver 由 read 循环调用, 不能阻塞
+func (sub *ClientSubscription) deliver(result json.RawMessage) {
+	select {
+	case sub.in <- result:
+	default:
+		go sub.quitWithError(ErrSubscriptionQueueOverflow, true)
+	}
+}
+
+// forward 将收到的通知解码后写入用户的 channel
+func (sub *ClientSubscription) forward() {
+	quitCase := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.quit)}
+	for {
+		select {
+		case raw := <-sub.in:
+			val := reflect.New(sub.etype)
+			if err := json.Unmarshal(raw, val.Interface()); err != nil {
+				sub.quitWithError(err, true)
+				return
+			}
+			sendCase := reflect.SelectCase{Dir: reflect.SelectSend, Chan: sub.channel, Send: val.Elem()}
+			if chosen, _, _ := reflect.Select([]reflect.SelectCase{sendCase, quitCase}); chosen == 1 {
+				return
+			}
+		case <-sub.quit:
+			return
+		}
+	}
+}
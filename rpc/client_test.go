@@ -0,0 +1,150 @@
+package rpc
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type notificationTestService struct{}
+
+// SomeSubscription 依次通知 0 到 n-1
+func (s *notificationTestService) SomeSubscription(ctx context.Context, n int) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := notifier.Notify(sub.ID, i); err != nil {
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+func newTestClientServer() *Server {
+	server := newTestServer()
+	if err := server.RegisterName("nftest", new(notificationTestService)); err != nil {
+		panic(err)
+	}
+	return server
+}
+
+func TestClientCall(t *testing.T) {
+	server := newTestClientServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "hello", 10); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if result.String != "hello" || result.Int != 10 {
+		t.Errorf("result mismatch: have %+v", result)
+	}
+	if err := client.Call(nil, "test_fail"); err == nil || err.Error() != "failed" {
+		t.Errorf("error mismatch: have %v", err)
+	}
+	if err := client.Call(nil, "test_unknown"); err == nil {
+		t.Errorf("expected error for unknown method")
+	}
+
+	modules, err := client.SupportedModules()
+	if err != nil {
+		t.Fatalf("failed to get modules: %v", err)
+	}
+	if _, ok := modules["test"]; !ok {
+		t.Errorf("module test missing: %v", modules)
+	}
+	var methods map[string][]string
+	if err := client.Call(&methods, "rpc_methods"); err != nil {
+		t.Fatalf("failed to get methods: %v", err)
+	}
+	if strings.Join(methods["test"], ",") != "blockNumber,echo,echoWithCtx,fail" {
+		t.Errorf("methods mismatch: have %v", methods["test"])
+	}
+
+	client.Close()
+	if err := client.Call(nil, "test_echo", "hello", 10); err != ErrClientQuit {
+		t.Errorf("error mismatch after close: have %v, want %v", err, ErrClientQuit)
+	}
+}
+
+func TestClientHTTP(t *testing.T) {
+	server := newTestClientServer()
+	defer server.Stop()
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	client, err := Dial(httpsrv.URL)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "http", 1); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if result.String != "http" || result.Int != 1 {
+		t.Errorf("result mismatch: have %+v", result)
+	}
+	if _, err := client.Subscribe(context.Background(), "nftest", make(chan int), "someSubscription", 1); err != ErrNotificationsUnsupported {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrNotificationsUnsupported)
+	}
+}
+
+func TestClientSubscribe(t *testing.T) {
+	server := newTestClientServer()
+	defer server.Stop()
+	httpsrv := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	defer httpsrv.Close()
+
+	client, err := Dial("ws://" + strings.TrimPrefix(httpsrv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	const n = 10
+	ch := make(chan int)
+	sub, err := client.Subscribe(context.Background(), "nftest", ch, "someSubscription", n)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case v := <-ch:
+			if v != i {
+				t.Fatalf("notification %d mismatch: have %d", i, v)
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription failed: %v", err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for notification %d", i)
+		}
+	}
+	sub.Unsubscribe()
+	if err, ok := <-sub.Err(); ok {
+		t.Errorf("unexpected error after unsubscribe: %v", err)
+	}
+
+	// 连接断开时, 订阅以错误结束
+	sub, err = client.Subscribe(context.Background(), "nftest", ch, "someSubscription", 0)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	client.Close()
+	select {
+	case err := <-sub.Err():
+		if err == nil {
+			t.Errorf("expected error when connection closed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timeout waiting for subscription error")
+	}
+}
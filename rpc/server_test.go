@@ -0,0 +1,224 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+type testService struct{}
+
+type echoResult struct {
+	String string
+	Int    int
+}
+
+func (s *testService) Echo(str string, i int) echoResult {
+	return echoResult{str, i}
+}
+
+func (s *testService) EchoWithCtx(ctx context.Context, str string, i int) echoResult {
+	return echoResult{str, i}
+}
+
+func (s *testService) Fail() error {
+	return errors.New("failed")
+}
+
+func (s *testService) BlockNumber(num BlockNumber) int64 {
+	return num.Int64()
+}
+
+func newTestServer() *Server {
+	server := NewServer()
+	if err := server.RegisterName("test", new(testService)); err != nil {
+		panic(err)
+	}
+	return server
+}
+
+func postJSON(t *testing.T, url, host, body string) (int, string) {
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("content-type", contentType)
+	if host != "" {
+		req.Host = host
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	return resp.StatusCode, strings.TrimSpace(buf.String())
+}
+
+func TestServerRegisterName(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(testService)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	svc, ok := server.services.services["test"]
+	if !ok {
+		t.Fatalf("Expected service calc to be registered")
+	}
+	if len(svc.callbacks) != 4 {
+		t.Errorf("Expected 4 callbacks for service 'test', got %d", len(svc.callbacks))
+	}
+	if err := server.RegisterName("empty", struct{}{}); err == nil {
+		t.Errorf("Expected error for service without methods")
+	}
+}
+
+func TestHTTPCalls(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tests := []struct {
+		req, resp string
+	}{
+		{
+			`{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",3]}`,
+			`{"jsonrpc":"2.0","id":1,"result":{"String":"x","Int":3}}`,
+		},
+		{
+			`{"jsonrpc":"2.0","id":2,"method":"test_echoWithCtx","params":["y",4]}`,
+			`{"jsonrpc":"2.0","id":2,"result":{"String":"y","Int":4}}`,
+		},
+		{
+			`{"jsonrpc":"2.0","id":3,"method":"test_blockNumber","params":["latest"]}`,
+			`{"jsonrpc":"2.0","id":3,"result":-1}`,
+		},
+		{
+			`{"jsonrpc":"2.0","id":4,"method":"test_fail","params":[]}`,
+			`{"jsonrpc":"2.0","id":4,"error":{"code":-32000,"message":"failed"}}`,
+		},
+		{
+			`{"jsonrpc":"2.0","id":5,"method":"test_missing","params":[]}`,
+			`{"jsonrpc":"2.0","id":5,"error":{"code":-32601,"message":"the method test_missing does not exist/is not available"}}`,
+		},
+		{
+			`{"jsonrpc":"2.0","id":6,"method":"test_echo","params":[1]}`,
+			`{"jsonrpc":"2.0","id":6,"error":{"code":-32602,"message":"invalid argument 0: json: cannot unmarshal number into Go value of type string"}}`,
+		},
+		{
+			`{"jsonrpc":"2.0","id":7,"method":"rpc_modules"}`,
+			`{"jsonrpc":"2.0","id":7,"result":{"rpc":"1.0","test":"1.0"}}`,
+		},
+		{
+			`[{"jsonrpc":"2.0","id":8,"method":"test_echo","params":["a",1]},{"jsonrpc":"2.0","method":"test_echo","params":["b",2]}]`,
+			`[{"jsonrpc":"2.0","id":8,"result":{"String":"a","Int":1}}]`,
+		},
+		{
+			`[]`,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"empty batch"}}`,
+		},
+		{
+			`{"jsonrpc":"2.0","method":"test_echo","params":["n",1]}`,
+			``,
+		},
+	}
+	for i, test := range tests {
+		code, resp := postJSON(t, ts.URL, "", test.req)
+		if code != http.StatusOK {
+			t.Fatalf("test %d: status mismatch: have %d, want %d", i, code, http.StatusOK)
+		}
+		if resp != test.resp {
+			t.Errorf("test %d: response mismatch\nhave %s\nwant %s", i, resp, test.resp)
+		}
+	}
+}
+
+func TestHTTPRequestValidation(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	ts := httptest.NewServer(NewHTTPServer([]string{"http://allowed.com"}, []string{"localhost"}, DefaultHTTPTimeouts, server).Handler)
+	defer ts.Close()
+
+	// 不在白名单中的 Host 被拒绝
+	if code, _ := postJSON(t, ts.URL, "evil.com", `{}`); code != http.StatusForbidden {
+		t.Errorf("vhost: status mismatch: have %d, want %d", code, http.StatusForbidden)
+	}
+	if code, _ := postJSON(t, ts.URL, "localhost:8545", `{"jsonrpc":"2.0","id":1,"method":"rpc_modules"}`); code != http.StatusOK {
+		t.Errorf("vhost: status mismatch: have %d, want %d", code, http.StatusOK)
+	}
+
+	// content-type 错误
+	resp, err := http.Post(ts.URL, "text/plain", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("content-type: status mismatch: have %d, want %d", resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+
+	// CORS
+	for _, test := range []struct {
+		origin, allow string
+	}{
+		{"http://allowed.com", "http://allowed.com"},
+		{"http://other.com", ""},
+	} {
+		req, _ := http.NewRequest(http.MethodOptions, ts.URL, nil)
+		req.Header.Set("Origin", test.origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if allow := resp.Header.Get("Access-Control-Allow-Origin"); allow != test.allow {
+			t.Errorf("origin %s: allow origin mismatch: have %q, want %q", test.origin, allow, test.allow)
+		}
+	}
+}
+
+func TestWebsocketCalls(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	ts := httptest.NewServer(server.WebsocketHandler([]string{"http://allowed.com"}))
+	defer ts.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	// Origin 不在白名单中时握手失败
+	header := http.Header{"Origin": []string{"http://evil.com"}}
+	if _, _, err := websocket.DefaultDialer.Dial(wsURL, header); err == nil {
+		t.Fatalf("expected handshake failure for disallowed origin")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	req := `{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["ws",9]}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	var resp jsonrpcMessage
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	var result echoResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("invalid result: %v", err)
+	}
+	if result != (echoResult{"ws", 9}) {
+		t.Fatalf("result mismatch: have %v", result)
+	}
+}